@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 type ActivityType string
@@ -15,6 +17,7 @@ const (
 	NewActivityType    ActivityType = "create"
 	ChangeActivityType              = "update"
 	DeleteActivityType              = "delete"
+	ReplyActivityType               = "create_reply"
 )
 
 type ActivityData struct {
@@ -28,11 +31,14 @@ type ActivityData struct {
 		Name string `json:"name"`
 		Type string `json:"type"`
 	} `json:"created_by"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Links       []string `json:"attachments"`
-	Media       []string `json:"media"`
-	UserGroups  []int64  `json:"user_groups"`
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	Links         []string `json:"attachments"`
+	Media         []string `json:"media"`
+	UserGroups    []int64  `json:"user_groups"`
+	GroupsFetched bool     `json:"groups_fetched"`           // UserGroups were requested, the visibility rules hide the update otherwise.
+	AttachmentIDs []int64  `json:"attachment_ids,omitempty"` // Attachments resolved into Links after formatting.
+	Errors        []string `json:"errors,omitempty"`
 }
 
 type ActivityRecord struct {
@@ -49,9 +55,13 @@ type ActivityUpdateRecord struct {
 	ID       int64        `json:"id"`
 	Type     ActivityType `json:"update_type"`
 	Metadata struct {
-		Type       string `json:"type"`
-		EntityType string `json:"entity_type"`
-		EntityID   int64  `json:"entity_id"`
+		Type          string      `json:"type"`
+		EntityType    string      `json:"entity_type"`
+		EntityID      int64       `json:"entity_id"`
+		AttributeName string      `json:"attribute_name"`
+		FieldDataType string      `json:"field_data_type"`
+		OldValue      interface{} `json:"old_value"`
+		NewValue      interface{} `json:"new_value"`
 	} `json:"meta"`
 	CreatedAt     string                 `json:"created_at"`
 	Read          bool                   `json:"read"`
@@ -91,7 +101,179 @@ type NoteActivityFields struct {
 	UserGroups []LinkField `json:"user.HumanUser.groups"`
 }
 
+type ActivityFormatter func(record ActivityUpdateRecord) *ActivityData
+
+type activityFormatterEntry struct {
+	fields    []string
+	formatter ActivityFormatter
+}
+
+var (
+	activityFormatters      = map[string]activityFormatterEntry{}
+	activityFormattersMutex sync.RWMutex
+)
+
+// RegisterActivityFormatter sets the formatter used for updates whose primary entity is of
+// entityType. The fields are requested for that entity type in every activity_stream call.
+// Formatters set ActivityData.GroupsFetched once they fill UserGroups from the fields, or the
+// visibility rules hide their updates.
+// Reply updates have their Note as primary entity, they use the "Reply" formatter.
+func RegisterActivityFormatter(entityType string, fields []string, formatter ActivityFormatter) {
+	activityFormattersMutex.Lock()
+	defer activityFormattersMutex.Unlock()
+	activityFormatters[entityType] = activityFormatterEntry{
+		fields:    fields,
+		formatter: formatter,
+	}
+}
+
+func getActivityFormatter(entityType string) (activityFormatterEntry, bool) {
+	activityFormattersMutex.RLock()
+	defer activityFormattersMutex.RUnlock()
+	entry, ok := activityFormatters[entityType]
+	return entry, ok
+}
+
+func init() {
+	RegisterActivityFormatter("Version", []string{
+		"sg_version_number", "description", "sg_download_uri",
+		"sg_uploaded_movie", "entity", "sg_task", "user.HumanUser.groups",
+	}, formatVersion)
+	RegisterActivityFormatter("Note", []string{
+		"subject", "content", "attachments", "note_links", "user.HumanUser.groups",
+	}, formatNote)
+	RegisterActivityFormatter("Reply", nil, formatReply)
+	RegisterActivityFormatter("Task", []string{
+		"content", "entity", "step", "sg_status_list", "created_by.HumanUser.groups",
+	}, formatTask)
+	RegisterActivityFormatter("PublishedFile", []string{
+		"code", "description", "entity", "task", "version_number", "published_file_type", "created_by.HumanUser.groups",
+	}, formatPublishedFile)
+}
+
+type TaskActivityFields struct {
+	ID         int64       `json:"id"`
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Entity     *LinkField  `json:"entity"`
+	Step       *LinkField  `json:"step"`
+	Status     string      `json:"sg_status_list"`
+	UserGroups []LinkField `json:"created_by.HumanUser.groups"`
+}
+
+type PublishedFileActivityFields struct {
+	ID            int64       `json:"id"`
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	Description   string      `json:"description"`
+	VersionNumber int64       `json:"version_number"`
+	Entity        *LinkField  `json:"entity"`
+	Task          *LinkField  `json:"task"`
+	FileType      *LinkField  `json:"published_file_type"`
+	UserGroups    []LinkField `json:"created_by.HumanUser.groups"`
+}
+
 func GetEntityActivity(entityType string, entityID int64, pageSize, latestActivityID int) ([]ActivityData, error) {
+	record, err := getActivityStream(entityType, entityID, pageSize, int64(latestActivityID))
+	if err != nil {
+		return nil, err
+	}
+
+	return formatActivityUpdates(record.Data.Updates), nil
+}
+
+// ActivityStreamPager walks the activity stream of an entity from the newest update to the
+// oldest, one page per call to Next.
+type ActivityStreamPager struct {
+	EntityType string
+	EntityID   int64
+	PageSize   int
+	Viewer     *UserData                // When set, updates the viewer is not allowed to see are dropped.
+	Visibility *ActivityVisibilityRules // Rules applied for Viewer, DefaultActivityVisibilityRules when nil.
+	maxID      int64
+	done       bool
+}
+
+func NewActivityStreamPager(entityType string, entityID int64, pageSize int) *ActivityStreamPager {
+	return &ActivityStreamPager{
+		EntityType: entityType,
+		EntityID:   entityID,
+		PageSize:   pageSize,
+	}
+}
+
+func (p *ActivityStreamPager) Done() bool {
+	return p.done
+}
+
+func (p *ActivityStreamPager) Next() ([]ActivityData, error) {
+	if p.done {
+		return nil, nil
+	}
+
+	record, err := getActivityStream(p.EntityType, p.EntityID, p.PageSize, p.maxID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only updates older than the previous page are new, a server may repeat the boundary.
+	var updates []ActivityUpdateRecord
+	earliestID := int64(0)
+	for _, update := range record.Data.Updates {
+		if p.maxID > 0 && update.ID > p.maxID {
+			continue
+		}
+		updates = append(updates, update)
+		if earliestID == 0 || update.ID < earliestID {
+			earliestID = update.ID
+		}
+	}
+	if record.Data.EarliestUpdateID > 0 && record.Data.EarliestUpdateID < earliestID {
+		earliestID = record.Data.EarliestUpdateID
+	}
+	if len(updates) == 0 {
+		logrus.WithField("max_id", p.maxID).Debug("activity stream has no updates past the previous page")
+		p.done = true
+		return nil, nil
+	}
+	p.maxID = earliestID - 1
+	if p.maxID <= 0 {
+		// Update ids start at 1, nothing is older than this page.
+		p.done = true
+	}
+
+	items := formatActivityUpdates(updates)
+	if p.Viewer != nil {
+		rules := p.Visibility
+		if rules == nil {
+			rules = &DefaultActivityVisibilityRules
+		}
+		items = rules.Filter(items, p.Viewer)
+	}
+
+	return items, nil
+}
+
+// SetViewer restricts the pages returned by Next to the updates visible to viewer.
+func (p *ActivityStreamPager) SetViewer(viewer *UserData, rules *ActivityVisibilityRules) *ActivityStreamPager {
+	p.Viewer = viewer
+	p.Visibility = rules
+	return p
+}
+
+func (p *ActivityStreamPager) All() ([]ActivityData, error) {
+	var result []ActivityData
+	for !p.Done() {
+		items, err := p.Next()
+		if err != nil {
+			return result, err
+		}
+		result = append(result, items...)
+	}
+	return result, nil
+}
+
+func getActivityStream(entityType string, entityID int64, pageSize int, maxID int64) (*ActivityRecord, error) {
 	activityStreamURL := ShotgunURL + fmt.Sprintf("/entity/%v/%v/activity_stream", entityType, entityID)
 	req, err := http.NewRequest("GET", activityStreamURL, nil)
 	if err != nil {
@@ -100,11 +282,16 @@ func GetEntityActivity(entityType string, entityID int64, pageSize, latestActivi
 	}
 	q := req.URL.Query()
 	q.Add("limit", strconv.Itoa(pageSize))
-	if latestActivityID > 0 {
-		q.Add("max_id", strconv.Itoa(latestActivityID))
+	if maxID > 0 {
+		q.Add("max_id", strconv.FormatInt(maxID, 10))
+	}
+	activityFormattersMutex.RLock()
+	for activityEntityType, entry := range activityFormatters {
+		if len(entry.fields) > 0 {
+			q.Add(fmt.Sprintf("entity_fields[%v]", activityEntityType), strings.Join(entry.fields, ","))
+		}
 	}
-	q.Add("entity_fields[Note]", "subject,content,attachments,note_links,user.HumanUser.groups")
-	q.Add("entity_fields[Version]", "sg_version_number,description,sg_download_uri,sg_uploaded_movie,entity,sg_task,user.HumanUser.groups")
+	activityFormattersMutex.RUnlock()
 	req.URL.RawQuery = q.Encode()
 
 	auth, err := AuthenticateShotgunScript()
@@ -138,38 +325,134 @@ func GetEntityActivity(entityType string, entityID int64, pageSize, latestActivi
 		return nil, err
 	}
 
+	return &record, nil
+}
+
+func formatActivityUpdates(updates []ActivityUpdateRecord) []ActivityData {
 	logrus.Debug("Start building ActivityData list..")
 	var result []ActivityData
-	for _, update := range record.Data.Updates {
-		switch update.Metadata.EntityType {
-		case "Version":
-			item := formatVersion(update)
-			if item != nil {
-				result = append(result, *item)
-				logrus.Debugf("Update added: %#v", item)
+	for _, update := range updates {
+		entityType := primaryEntityType(update)
+		if update.Type == ReplyActivityType {
+			entityType = "Reply"
+		}
+
+		formatter := formatUpdate
+		if entry, ok := getActivityFormatter(entityType); ok {
+			formatter = entry.formatter
+		}
+
+		item := formatter(update)
+		if item == nil {
+			logrus.Debugf("Update skipped by formatter: %#v", update)
+			continue
+		}
+		result = append(result, *item)
+		logrus.Debugf("Update added: %#v", item)
+	}
+
+	resolveActivityAttachments(result)
+
+	return result
+}
+
+// resolveActivityAttachments looks up the Attachments of every item with a single search and
+// appends their URLs to the item Links. Failures are recorded on the affected items.
+func resolveActivityAttachments(items []ActivityData) {
+	var attachmentIDs []int64
+	seen := map[int64]bool{}
+	for _, item := range items {
+		for _, id := range item.AttachmentIDs {
+			if !seen[id] {
+				seen[id] = true
+				attachmentIDs = append(attachmentIDs, id)
 			}
-		case "Note":
-			item := formatNote(update)
-			if item != nil {
-				result = append(result, *item)
-				logrus.Debugf("Update added: %#v", item)
+		}
+	}
+	if len(attachmentIDs) == 0 {
+		return
+	}
+
+	attachments, err := GetAttachmentsForIDs(attachmentIDs)
+	if err != nil {
+		logrus.WithError(err).Error("failed to retrieve Attachments for activity stream")
+	}
+
+	attachmentURLs := map[int64]string{}
+	for _, attachment := range attachments {
+		attachmentURLs[attachment.ID] = attachment.FileURL
+	}
+
+	for i := range items {
+		for _, id := range items[i].AttachmentIDs {
+			url, ok := attachmentURLs[id]
+			switch {
+			case err != nil:
+				items[i].Errors = append(items[i].Errors, fmt.Sprintf("failed to retrieve Attachment %v: %v", id, err))
+			case !ok:
+				items[i].Errors = append(items[i].Errors, fmt.Sprintf("Attachment %v not found", id))
+			default:
+				items[i].Links = append(items[i].Links, url)
 			}
-		default:
-			logrus.Debugf("Update skipped because it doesnt meet entity type requirements: %#v", update)
 		}
 	}
+}
 
-	return result, nil
+func primaryEntityType(record ActivityUpdateRecord) string {
+	if entityType, ok := record.PrimaryEntity["type"].(string); ok && entityType != "" {
+		return entityType
+	}
+	return record.Metadata.EntityType
 }
 
-func formatVersion(record ActivityUpdateRecord) *ActivityData {
+// newActivityData creates the item of an update whose formatter requested the author groups.
+func newActivityData(record ActivityUpdateRecord, entityType string, entityID int64, groups []LinkField) ActivityData {
+	var item ActivityData
+	item.EntityType = entityType
+	item.EntityID = entityID
+	item.GroupsFetched = true
+	for _, group := range groups {
+		item.UserGroups = append(item.UserGroups, group.ID)
+	}
+
+	item.CreatedAt = record.CreatedAt
+	item.CreatedBy.ID = record.CreatedBy.ID
+	item.CreatedBy.Type = record.CreatedBy.Type
+	item.CreatedBy.Name = record.CreatedBy.Name
+	item.ID = record.ID
+	item.Type = record.Type
+	return item
+}
+
+func unmarshalPrimaryEntity(record ActivityUpdateRecord, v interface{}) {
 	jsonStr, _ := json.Marshal(record.PrimaryEntity)
-	var keys []string
-	for k := range record.PrimaryEntity {
-		keys = append(keys, k)
+	json.Unmarshal(jsonStr, v)
+}
+
+func describeAttributeChange(record ActivityUpdateRecord) string {
+	if record.Metadata.Type != "attribute_change" || record.Metadata.AttributeName == "" {
+		return ""
 	}
+	return fmt.Sprintf("%v changed from %v to %v",
+		record.Metadata.AttributeName, formatActivityValue(record.Metadata.OldValue), formatActivityValue(record.Metadata.NewValue),
+	)
+}
+
+func formatActivityValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "(empty)"
+	case map[string]interface{}:
+		if name, ok := v["name"]; ok {
+			return fmt.Sprintf("%v", name)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func formatVersion(record ActivityUpdateRecord) *ActivityData {
 	var versionFields VersionActivityFields
-	json.Unmarshal(jsonStr, &versionFields)
+	unmarshalPrimaryEntity(record, &versionFields)
 
 	if versionFields.Type != "Version" {
 		logrus.Debug("Record is not a Version entity, skipping.")
@@ -185,19 +468,7 @@ func formatVersion(record ActivityUpdateRecord) *ActivityData {
 		logrus.WithFields(record.PrimaryEntity).Debugf("Version record has no interesting data.")
 	}
 
-	var item ActivityData
-	item.EntityType = versionFields.Type
-	item.EntityID = versionFields.ID
-	for _, group := range versionFields.UserGroups {
-		item.UserGroups = append(item.UserGroups, group.ID)
-	}
-
-	item.CreatedAt = record.CreatedAt
-	item.CreatedBy.ID = record.CreatedBy.ID
-	item.CreatedBy.Type = record.CreatedBy.Type
-	item.CreatedBy.Name = record.CreatedBy.Name
-	item.ID = record.ID
-	item.Type = record.Type
+	item := newActivityData(record, versionFields.Type, versionFields.ID, versionFields.UserGroups)
 
 	switch record.Type {
 	case "create":
@@ -210,7 +481,12 @@ func formatVersion(record ActivityUpdateRecord) *ActivityData {
 		item.Title = fmt.Sprintf("Version from %v", record.CreatedBy.Name)
 	}
 
-	item.Description = fmt.Sprintf("Task: %v \n%v: %v", versionFields.Task.Name, versionFields.Entity.Type, versionFields.Entity.Name)
+	if versionFields.Task != nil && versionFields.Entity != nil {
+		item.Description = fmt.Sprintf("Task: %v \n%v: %v", versionFields.Task.Name, versionFields.Entity.Type, versionFields.Entity.Name)
+	}
+	if change := describeAttributeChange(record); change != "" {
+		item.Description = change
+	}
 
 	if item.Description == "" {
 		item.Description = fmt.Sprintf("Version update from %v", record.CreatedBy.Name)
@@ -230,13 +506,8 @@ func formatVersion(record ActivityUpdateRecord) *ActivityData {
 }
 
 func formatNote(record ActivityUpdateRecord) *ActivityData {
-	jsonStr, _ := json.Marshal(record.PrimaryEntity)
-	var keys []string
-	for k := range record.PrimaryEntity {
-		keys = append(keys, k)
-	}
 	var noteFields NoteActivityFields
-	json.Unmarshal(jsonStr, &noteFields)
+	unmarshalPrimaryEntity(record, &noteFields)
 
 	if noteFields.Type != "Note" {
 		logrus.Debug("Record is not a Note entity, skipping.")
@@ -252,19 +523,7 @@ func formatNote(record ActivityUpdateRecord) *ActivityData {
 		logrus.WithFields(record.PrimaryEntity).Debugf("Note record has no interesting data.")
 	}
 
-	var item ActivityData
-	item.EntityType = noteFields.Type
-	item.EntityID = noteFields.ID
-	for _, group := range noteFields.UserGroups {
-		item.UserGroups = append(item.UserGroups, group.ID)
-	}
-
-	item.CreatedAt = record.CreatedAt
-	item.CreatedBy.ID = record.CreatedBy.ID
-	item.CreatedBy.Type = record.CreatedBy.Type
-	item.CreatedBy.Name = record.CreatedBy.Name
-	item.ID = record.ID
-	item.Type = record.Type
+	item := newActivityData(record, noteFields.Type, noteFields.ID, noteFields.UserGroups)
 	item.Title = noteFields.Subject
 	if item.Title == "" {
 		msg := "Note(s): "
@@ -283,14 +542,129 @@ func formatNote(record ActivityUpdateRecord) *ActivityData {
 	}
 
 	for _, a := range noteFields.Attachments {
-		attachment, err := GetAttachmentFromID(a.ID)
-		if err != nil {
-			logrus.WithField("attachment_id", a).Error("failed to retrieve Attachment")
-			continue
+		item.AttachmentIDs = append(item.AttachmentIDs, a.ID)
+	}
+
+	return &item
+}
+
+// formatReply formats create_reply updates. Their primary entity is the Note replied to, the
+// Reply itself is only referenced by the update metadata.
+func formatReply(record ActivityUpdateRecord) *ActivityData {
+	if record.Metadata.EntityType != "Reply" || record.Metadata.EntityID == 0 {
+		logrus.Debug("Record has no Reply entity, skipping.")
+		return nil
+	}
+
+	var noteFields NoteActivityFields
+	unmarshalPrimaryEntity(record, &noteFields)
+
+	item := newActivityData(record, "Reply", record.Metadata.EntityID, noteFields.UserGroups)
+	item.Title = fmt.Sprintf("Reply from %v", record.CreatedBy.Name)
+	if noteFields.Subject != "" {
+		item.Title = fmt.Sprintf("Reply to %v", noteFields.Subject)
+	} else if noteFields.Name != "" {
+		item.Title = fmt.Sprintf("Reply to %v", noteFields.Name)
+	}
+
+	return &item
+}
+
+func formatTask(record ActivityUpdateRecord) *ActivityData {
+	var taskFields TaskActivityFields
+	unmarshalPrimaryEntity(record, &taskFields)
+
+	if taskFields.Type != "Task" {
+		logrus.Debug("Record is not a Task entity, skipping.")
+		return nil
+	}
+
+	item := newActivityData(record, taskFields.Type, taskFields.ID, taskFields.UserGroups)
+	switch record.Type {
+	case NewActivityType:
+		item.Title = fmt.Sprintf("New Task: %v", taskFields.Name)
+	case ChangeActivityType:
+		item.Title = fmt.Sprintf("Updated Task: %v", taskFields.Name)
+	case DeleteActivityType:
+		item.Title = fmt.Sprintf("Removed Task: %v", taskFields.Name)
+	default:
+		item.Title = fmt.Sprintf("Task from %v", record.CreatedBy.Name)
+	}
+
+	item.Description = describeAttributeChange(record)
+	if item.Description == "" && taskFields.Entity != nil {
+		item.Description = fmt.Sprintf("%v: %v \nStatus: %v", taskFields.Entity.Type, taskFields.Entity.Name, taskFields.Status)
+	}
+
+	return &item
+}
+
+func formatPublishedFile(record ActivityUpdateRecord) *ActivityData {
+	var publishFields PublishedFileActivityFields
+	unmarshalPrimaryEntity(record, &publishFields)
+
+	if publishFields.Type != "PublishedFile" {
+		logrus.Debug("Record is not a PublishedFile entity, skipping.")
+		return nil
+	}
+
+	item := newActivityData(record, publishFields.Type, publishFields.ID, publishFields.UserGroups)
+	switch record.Type {
+	case NewActivityType:
+		item.Title = fmt.Sprintf("New Publish: %v", publishFields.Name)
+	case ChangeActivityType:
+		item.Title = fmt.Sprintf("Updated Publish: %v", publishFields.Name)
+	case DeleteActivityType:
+		item.Title = fmt.Sprintf("Removed Publish: %v", publishFields.Name)
+	default:
+		item.Title = fmt.Sprintf("Publish from %v", record.CreatedBy.Name)
+	}
+
+	item.Description = describeAttributeChange(record)
+	if item.Description == "" {
+		if publishFields.FileType != nil {
+			item.Description = fmt.Sprintf("%v v%03d", publishFields.FileType.Name, publishFields.VersionNumber)
+		}
+		if publishFields.Description != "" {
+			item.Description += fmt.Sprintf("\n %v", publishFields.Description)
 		}
+	}
 
-		item.Links = append(item.Links, attachment.FileURL)
+	return &item
+}
+
+// formatUpdate is used for entity types without a registered formatter. The groups of these
+// updates are not requested, so they are only visible to admins.
+func formatUpdate(record ActivityUpdateRecord) *ActivityData {
+	var entity LinkField
+	unmarshalPrimaryEntity(record, &entity)
+	if entity.Type == "" {
+		entity.Type = record.Metadata.EntityType
+		entity.ID = record.Metadata.EntityID
+	}
+
+	if entity.Type == "" {
+		logrus.Debug("Record has no primary entity, skipping.")
+		return nil
+	}
+
+	item := newActivityData(record, entity.Type, entity.ID, nil)
+	item.GroupsFetched = false
+	name := entity.Name
+	if name == "" {
+		name = fmt.Sprintf("%v %v", entity.Type, entity.ID)
+	}
+	switch record.Type {
+	case NewActivityType:
+		item.Title = fmt.Sprintf("New %v: %v", entity.Type, name)
+	case ChangeActivityType:
+		item.Title = fmt.Sprintf("Updated %v: %v", entity.Type, name)
+	case DeleteActivityType:
+		item.Title = fmt.Sprintf("Removed %v: %v", entity.Type, name)
+	default:
+		item.Title = fmt.Sprintf("%v from %v", entity.Type, record.CreatedBy.Name)
 	}
+	item.Description = describeAttributeChange(record)
 
 	return &item
 }
@@ -0,0 +1,70 @@
+package shotgun_api
+
+type ActivityVisibilityRules struct {
+	AllowGroups   []int64 `json:"allow_groups"`   // Updates from members of these groups are visible to every viewer.
+	DenyGroups    []int64 `json:"deny_groups"`    // Updates from members of these groups are hidden from everyone but admins.
+	AdminGroups   []int64 `json:"admin_groups"`   // Viewers in these groups see every update.
+	ShowUngrouped bool    `json:"show_ungrouped"` // Show updates whose author belongs to no group.
+}
+
+var DefaultActivityVisibilityRules = ActivityVisibilityRules{
+	ShowUngrouped: true,
+}
+
+// FilterActivityForUser hides the updates whose author groups do not intersect the groups of
+// the viewer, using DefaultActivityVisibilityRules.
+func FilterActivityForUser(activities []ActivityData, viewer *UserData) []ActivityData {
+	return DefaultActivityVisibilityRules.Filter(activities, viewer)
+}
+
+func (r *ActivityVisibilityRules) Filter(activities []ActivityData, viewer *UserData) []ActivityData {
+	var result []ActivityData
+	for _, activity := range activities {
+		if r.CanView(activity, viewer) {
+			result = append(result, activity)
+		}
+	}
+	return result
+}
+
+// CanView fails closed: updates whose author groups were never fetched are only visible to
+// admins.
+func (r *ActivityVisibilityRules) CanView(activity ActivityData, viewer *UserData) bool {
+	if viewer == nil {
+		return false
+	}
+
+	viewerGroups := make([]int64, len(viewer.Groups))
+	for i, group := range viewer.Groups {
+		viewerGroups[i] = group.ID
+	}
+
+	if groupsIntersect(viewerGroups, r.AdminGroups) {
+		return true
+	}
+	if !activity.GroupsFetched {
+		return false
+	}
+	if groupsIntersect(activity.UserGroups, r.DenyGroups) {
+		return false
+	}
+	if groupsIntersect(activity.UserGroups, r.AllowGroups) {
+		return true
+	}
+	if len(activity.UserGroups) == 0 {
+		return r.ShowUngrouped
+	}
+
+	return groupsIntersect(activity.UserGroups, viewerGroups)
+}
+
+func groupsIntersect(a, b []int64) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,25 +2,28 @@ package shotgun_api
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/sirupsen/logrus"
 )
 
 type AssetData struct {
-	ID    int64  `json:"id"`
-	Group string `json:"group"`
-	Name  string `json:"name"`
+	ID     int64  `json:"id"`
+	Group  string `json:"group"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
 }
 
 type AssetRecord struct {
 	ID         int64 `json:"id"`
 	Attributes struct {
-		Code string `json:"code"`
-		Type string `json:"sg_asset_type"`
+		Code   string `json:"code"`
+		Type   string `json:"sg_asset_type"`
+		Status string `json:"sg_status_list"`
 	} `json:"attributes"`
 }
 
 var assetFields = []string{
-	"id", "code", "sg_asset_type",
+	"id", "code", "sg_asset_type", "sg_status_list",
 }
 
 type AssetMultiRecordResponse struct {
@@ -62,9 +65,10 @@ func GetAssetForID(assetID int64) (*AssetData, error) {
 	}
 
 	result := &AssetData{
-		ID:    resp.Data.ID,
-		Name:  resp.Data.Attributes.Code,
-		Group: resp.Data.Attributes.Type,
+		ID:     resp.Data.ID,
+		Name:   resp.Data.Attributes.Code,
+		Group:  resp.Data.Attributes.Type,
+		Status: resp.Data.Attributes.Status,
 	}
 
 	return result, nil
@@ -97,9 +101,10 @@ func GetProjectAssets(projectID int64) ([]AssetData, error) {
 	var result []AssetData
 	for _, record := range resp.Data {
 		asset := AssetData{
-			ID:    record.ID,
-			Name:  record.Attributes.Code,
-			Group: record.Attributes.Type,
+			ID:     record.ID,
+			Name:   record.Attributes.Code,
+			Group:  record.Attributes.Type,
+			Status: record.Attributes.Status,
 		}
 
 		result = append(result, asset)
@@ -107,3 +112,37 @@ func GetProjectAssets(projectID int64) ([]AssetData, error) {
 
 	return result, nil
 }
+
+func GetAssetByCode(projectID int64, code string) (*AssetData, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"project.Project.id", "is", projectID},
+			{"code", "is", code},
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+	req, err := NewSearchRequest("Asset", filters, assetFields, &page, nil)
+	if err != nil {
+		logrus.Error("failed to create Asset search request")
+		return nil, err
+	}
+
+	var resp AssetMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Asset search request")
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no Assets found with code: %v", code)
+	}
+
+	return &AssetData{
+		ID:     resp.Data[0].ID,
+		Name:   resp.Data[0].Attributes.Code,
+		Group:  resp.Data[0].Attributes.Type,
+		Status: resp.Data[0].Attributes.Status,
+	}, nil
+}
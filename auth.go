@@ -18,10 +18,24 @@ type ShotgunAuth struct {
 }
 
 func AuthenticateShotgunScript() (*ShotgunAuth, error) {
+	return authenticateShotgunScript("")
+}
+
+// AuthenticateShotgunScriptAsUser authenticates the script to act as the HumanUser with the
+// given login, for per-user state such as whether a note was read. The script needs the sudo
+// permission for this.
+func AuthenticateShotgunScriptAsUser(login string) (*ShotgunAuth, error) {
+	return authenticateShotgunScript("sudo_as_login:" + login)
+}
+
+func authenticateShotgunScript(scope string) (*ShotgunAuth, error) {
 	data := url.Values{}
 	data.Set("client_id", os.Getenv("SHOTGUN_CLIENT_ID"))
 	data.Set("client_secret", os.Getenv("SHOTGUN_SECRET"))
 	data.Set("grant_type", "client_credentials")
+	if scope != "" {
+		data.Set("scope", scope)
+	}
 
 	authURL := ShotgunURL + "/auth/access_token"
 	req, _ := http.NewRequest("POST", authURL, strings.NewReader(data.Encode()))
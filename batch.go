@@ -0,0 +1,139 @@
+package shotgun_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+type BatchRequestType string
+
+const (
+	BatchCreate BatchRequestType = "create"
+	BatchUpdate BatchRequestType = "update"
+	BatchDelete BatchRequestType = "delete"
+)
+
+// maxBatchSize is the number of requests sent in one _batch call.
+const maxBatchSize = 100
+
+type BatchRequestItem struct {
+	RequestType BatchRequestType       `json:"request_type"`
+	Entity      string                 `json:"entity"`
+	RecordID    int64                  `json:"record_id,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+}
+
+// NewBatchRequest creates a request running several creates, updates and deletes in a single
+// transaction. Shotgun rolls back the whole batch when one of them fails.
+func NewBatchRequest(items []BatchRequestItem) (*http.Request, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"requests": items,
+	})
+	if err != nil {
+		logrus.Error("failed to marshal batch request to JSON")
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", ShotgunURL+"/entity/_batch", bytes.NewBuffer(data))
+	if err != nil {
+		logrus.WithError(err).Error("failed to create batch request")
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// DoBatchRequest runs a batch request. The response has one record per request, in order.
+func DoBatchRequest(req *http.Request, handler MultiRecordHandler) error {
+	auth, err := AuthenticateShotgunScript()
+	if err != nil {
+		logrus.Error("authentication failed")
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+	token := fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken)
+	req.Header.Add("Authorization", token)
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		logrus.Error("failed to do batch request")
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return HandleError(resp)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logrus.Error("failed to read batch response")
+		return err
+	}
+
+	if err = handler.ReadRecord(bodyBytes); err != nil {
+		logrus.Error("failed to read batch MultiRecord")
+		return err
+	}
+
+	return nil
+}
+
+// RunBatch sends the requests in batches of up to 100 and returns the records of all of them.
+// Batches sent before a failing one are not rolled back, their records are returned with the
+// error.
+func RunBatch(items []BatchRequestItem) ([]GenericRecord, error) {
+	var result []GenericRecord
+	for start := 0; start < len(items); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		req, err := NewBatchRequest(items[start:end])
+		if err != nil {
+			return result, err
+		}
+
+		var resp batchResponse
+		if err = DoBatchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make batch request")
+			return result, err
+		}
+		result = append(result, resp.records...)
+	}
+
+	return result, nil
+}
+
+// batchResponse reads the results of a batch. Deletes return no record, they are left as an
+// empty GenericRecord so the results stay aligned with the requests.
+type batchResponse struct {
+	records []GenericRecord
+}
+
+func (b *batchResponse) ReadRecord(data []byte) error {
+	var resp struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		logrus.Error("failed to unmarshal batch response")
+		return err
+	}
+
+	for _, raw := range resp.Data {
+		var record GenericRecord
+		if len(raw) > 0 && raw[0] == '{' {
+			if err := json.Unmarshal(raw, &record); err != nil {
+				logrus.Error("failed to unmarshal batch response record")
+				return err
+			}
+		}
+		b.records = append(b.records, record)
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+// Context describes where a piece of work lives in Shotgun, so it can be handed between tools
+// without re-querying the entity hierarchy.
+type Context struct {
+	Project       LinkField  `json:"project"`
+	Entity        *LinkField `json:"entity,omitempty"`
+	Sequence      *LinkField `json:"sequence,omitempty"`
+	AssetType     string     `json:"asset_type,omitempty"`
+	Step          *LinkField `json:"step,omitempty"`
+	StepShortName string     `json:"step_short_name,omitempty"`
+	Task          *LinkField `json:"task,omitempty"`
+	User          *LinkField `json:"user,omitempty"`
+	Source        *LinkField `json:"source,omitempty"` // Version or PublishedFile the context was built from.
+}
+
+type contextFieldSpec struct {
+	project, entity, task, step, stepShortName, user string
+}
+
+// contextFields lists, per entity type, the fields that hold each part of the context.
+// Deep links are used so the whole context comes back from a single search.
+var contextFields = map[string]contextFieldSpec{
+	"Version": {
+		project:       "project",
+		entity:        "entity",
+		task:          "sg_task",
+		step:          "sg_task.Task.step",
+		stepShortName: "sg_task.Task.step.Step.short_name",
+		user:          "user",
+	},
+	"PublishedFile": {
+		project:       "project",
+		entity:        "entity",
+		task:          "task",
+		step:          "task.Task.step",
+		stepShortName: "task.Task.step.Step.short_name",
+		user:          "created_by",
+	},
+	"Task": {
+		project:       "project",
+		entity:        "entity",
+		step:          "step",
+		stepShortName: "step.Step.short_name",
+	},
+	"Note": {
+		project: "project",
+		user:    "user",
+	},
+}
+
+func (s contextFieldSpec) fields() []string {
+	fields := []string{"id"}
+	for _, field := range []string{s.project, s.entity, s.task, s.step, s.stepShortName, s.user} {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if s.entity != "" {
+		fields = append(fields, s.entity+".Shot.sg_sequence", s.entity+".Asset.sg_asset_type")
+	}
+	return fields
+}
+
+// NewContextFromEntity builds the Context of any entity with one search request, or none when
+// the entity is a Project.
+func NewContextFromEntity(entity LinkField) (*Context, error) {
+	switch entity.Type {
+	case "Project":
+		return &Context{Project: entity}, nil
+	case "Shot":
+		return newContextFromParent(entity, "project", "sg_sequence", "")
+	case "Asset":
+		return newContextFromParent(entity, "project", "", "sg_asset_type")
+	case "Sequence":
+		return newContextFromParent(entity, "project", "", "")
+	}
+
+	spec, ok := contextFields[entity.Type]
+	if !ok {
+		spec = contextFieldSpec{project: "project"}
+	}
+
+	record, err := findGenericRecord(entity, spec.fields())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &Context{
+		Entity:        record.link(spec.entity),
+		Task:          record.link(spec.task),
+		Step:          record.link(spec.step),
+		StepShortName: record.attribute(spec.stepShortName),
+		User:          record.link(spec.user),
+	}
+	if project := record.link(spec.project); project != nil {
+		ctx.Project = *project
+	}
+	if ctx.Entity != nil {
+		switch ctx.Entity.Type {
+		case "Shot":
+			ctx.Sequence = record.link(spec.entity + ".Shot.sg_sequence")
+		case "Asset":
+			ctx.AssetType = record.attribute(spec.entity + ".Asset.sg_asset_type")
+		}
+	}
+
+	switch entity.Type {
+	case "Version", "PublishedFile":
+		source := entity
+		ctx.Source = &source
+	case "Task":
+		task := entity
+		ctx.Task = &task
+	}
+
+	return ctx, nil
+}
+
+func newContextFromParent(entity LinkField, projectField, sequenceField, assetTypeField string) (*Context, error) {
+	fields := []string{"id", "code", projectField}
+	if sequenceField != "" {
+		fields = append(fields, sequenceField)
+	}
+	if assetTypeField != "" {
+		fields = append(fields, assetTypeField)
+	}
+
+	record, err := findGenericRecord(entity, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if entity.Name == "" {
+		entity.Name = record.attribute("code")
+	}
+	ctx := &Context{
+		Entity:    &entity,
+		AssetType: record.attribute(assetTypeField),
+	}
+	if project := record.link(projectField); project != nil {
+		ctx.Project = *project
+	}
+	if sequenceField != "" {
+		ctx.Sequence = record.link(sequenceField)
+	}
+
+	return ctx, nil
+}
+
+// TemplateFields returns the path template fields known from the context.
+func (c *Context) TemplateFields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"Project": c.Project.Name,
+	}
+	if c.Entity != nil {
+		switch c.Entity.Type {
+		case "Shot":
+			fields["Shot"] = c.Entity.Name
+		case "Asset":
+			fields["Asset"] = c.Entity.Name
+		}
+	}
+	if c.Sequence != nil {
+		fields["Sequence"] = c.Sequence.Name
+	}
+	if c.AssetType != "" {
+		fields["AssetType"] = c.AssetType
+	}
+	if c.StepShortName != "" {
+		fields["Step"] = c.StepShortName
+	}
+	if c.Task != nil {
+		fields["Task"] = c.Task.Name
+	}
+	return fields
+}
+
+func (c *Context) Serialize() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		logrus.Error("failed to marshal Context")
+		return "", err
+	}
+	return string(data), nil
+}
+
+func DeserializeContext(data string) (*Context, error) {
+	var ctx Context
+	if err := json.Unmarshal([]byte(data), &ctx); err != nil {
+		logrus.Error("failed to unmarshal Context")
+		return nil, err
+	}
+	return &ctx, nil
+}
+
+// GenericRecord is a record of any entity type, for requests whose fields are only known at
+// runtime.
+type GenericRecord struct {
+	ID            int64                      `json:"id"`
+	Type          string                     `json:"type"`
+	Attributes    map[string]json.RawMessage `json:"attributes"`
+	Relationships map[string]struct {
+		Data json.RawMessage `json:"data"`
+	} `json:"relationships"`
+}
+
+type GenericMultiRecordResponse struct {
+	Data []GenericRecord `json:"data"`
+}
+
+func (t *GenericMultiRecordResponse) ReadRecord(data []byte) error {
+	err := json.Unmarshal(data, &t)
+	if err != nil {
+		logrus.Error("failed to unmarshal data to GenericMultiRecord")
+		return err
+	}
+	return nil
+}
+
+type GenericRecordResponse struct {
+	Data GenericRecord `json:"data"`
+}
+
+func (e *GenericRecordResponse) ReadRecord(data []byte) error {
+	if err := json.Unmarshal(data, &e); err != nil {
+		logrus.Error("failed to unmarshal GenericRecord response")
+		return err
+	}
+	return nil
+}
+
+func (r *GenericRecord) raw(field string) json.RawMessage {
+	if field == "" {
+		return nil
+	}
+	if rel, ok := r.Relationships[field]; ok {
+		return rel.Data
+	}
+	return r.Attributes[field]
+}
+
+func (r *GenericRecord) link(field string) *LinkField {
+	raw := r.raw(field)
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var result LinkField
+	if err := json.Unmarshal(raw, &result); err != nil || result.Type == "" {
+		return nil
+	}
+	return &result
+}
+
+func (r *GenericRecord) links(field string) []LinkField {
+	var result []LinkField
+	if raw := r.raw(field); len(raw) > 0 {
+		json.Unmarshal(raw, &result)
+	}
+	return result
+}
+
+func (r *GenericRecord) attribute(field string) string {
+	raw := r.raw(field)
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(raw, &result); err != nil || result == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", result)
+}
+
+func findGenericRecord(entity LinkField, fields []string) (*GenericRecord, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"id", "is", entity.ID},
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+	req, err := NewSearchRequest(entity.Type, filters, fields, &page, nil)
+	if err != nil {
+		logrus.Errorf("failed to create %v search request", entity.Type)
+		return nil, err
+	}
+
+	var resp GenericMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Errorf("failed to make %v search request", entity.Type)
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no %v found with id: %v", entity.Type, entity.ID)
+	}
+
+	return &resp.Data[0], nil
+}
@@ -16,6 +16,11 @@ type LinkField struct {
 	Name string `json:"name,omitempty"`
 }
 
+// Ref returns the link without its display name, as expected in create and update requests.
+func (l LinkField) Ref() LinkField {
+	return LinkField{ID: l.ID, Type: l.Type}
+}
+
 type ShotgunFilterExpression struct {
 	Field    string
 	Relation string
@@ -0,0 +1,42 @@
+package shotgun_api
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+func NewDeleteRequest(entityType string, entityID int64) (*http.Request, error) {
+	url := ShotgunURL + fmt.Sprintf("/entity/%v/%v", entityType, entityID)
+
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		logrus.WithError(err).Error("failed to create delete request")
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func DoDeleteRequest(req *http.Request) error {
+	auth, err := AuthenticateShotgunScript()
+	if err != nil {
+		logrus.Error("authentication failed")
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+	token := fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken)
+	req.Header.Add("Authorization", token)
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		logrus.Error("failed to do delete request")
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return HandleError(resp)
+	}
+
+	return nil
+}
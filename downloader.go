@@ -0,0 +1,508 @@
+package shotgun_api
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// urlExpiryMargin is how long before its expiry a signed URL is re-signed, so a download is
+// not started with a URL about to expire.
+const urlExpiryMargin = 30 * time.Second
+
+type DownloadJob struct {
+	URL      string                 // Signed URL of the file.
+	FileName string                 // Name of the file in the download directory.
+	Checksum string                 // Optional expected checksum, "sha256:<hex>" or "md5:<hex>".
+	Refresh  func() (string, error) // Returns a newly signed URL when URL has expired.
+}
+
+type DownloadResult struct {
+	Job  DownloadJob `json:"job"`
+	Path string      `json:"path"`
+	Size int64       `json:"size"`
+	Err  error       `json:"-"`
+}
+
+type DownloadProgressFunc func(job DownloadJob, received, total int64)
+
+type Downloader struct {
+	Dir         string
+	Concurrency int
+	Progress    DownloadProgressFunc
+}
+
+func NewDownloader(dir string, concurrency int) *Downloader {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Downloader{
+		Dir:         dir,
+		Concurrency: concurrency,
+	}
+}
+
+// activeDownloads holds the targets being downloaded, so two downloads never write the same
+// .part file.
+var (
+	activeDownloads      = map[string]bool{}
+	activeDownloadsMutex sync.Mutex
+)
+
+func claimDownloadTarget(target string) bool {
+	activeDownloadsMutex.Lock()
+	defer activeDownloadsMutex.Unlock()
+	if activeDownloads[target] {
+		return false
+	}
+	activeDownloads[target] = true
+	return true
+}
+
+func releaseDownloadTarget(target string) {
+	activeDownloadsMutex.Lock()
+	defer activeDownloadsMutex.Unlock()
+	delete(activeDownloads, target)
+}
+
+// Download fetches every job, running up to Concurrency downloads at once. The results are in
+// the same order as the jobs. A job with the same target as an earlier job fails without
+// being downloaded.
+func (d *Downloader) Download(jobs []DownloadJob) []DownloadResult {
+	results := make([]DownloadResult, len(jobs))
+	indexes := make(chan int)
+
+	var pending []int
+	targets := map[string]int{}
+	for i, job := range jobs {
+		target := d.targetPath(job)
+		if first, ok := targets[target]; ok && target != "" {
+			results[i] = DownloadResult{
+				Job:  job,
+				Path: target,
+				Err:  fmt.Errorf("download of %v has the same target as job %v", job.FileName, first),
+			}
+			continue
+		}
+		targets[target] = i
+		pending = append(pending, i)
+	}
+
+	concurrency := d.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = d.DownloadOne(jobs[index])
+			}
+		}()
+	}
+
+	for _, i := range pending {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// targetPath returns where a job is downloaded to, or an empty string when it has no file name.
+func (d *Downloader) targetPath(job DownloadJob) string {
+	if job.FileName == "" {
+		job.FileName = fileNameFromURL(job.URL)
+	}
+	if job.FileName == "" {
+		return ""
+	}
+	return filepath.Join(d.Dir, filepath.Base(job.FileName))
+}
+
+// DownloadOne fetches a single file into a .part file next to its target, resuming a previous
+// partial download with a Range request, and renames it into place once it is verified. The
+// returned Job has the file name and URL actually used.
+func (d *Downloader) DownloadOne(job DownloadJob) DownloadResult {
+	result := d.downloadOne(&job)
+	result.Job = job
+	return result
+}
+
+func (d *Downloader) downloadOne(job *DownloadJob) DownloadResult {
+	var result DownloadResult
+	if job.FileName == "" {
+		job.FileName = fileNameFromURL(job.URL)
+	}
+	if job.FileName == "" {
+		result.Err = fmt.Errorf("no file name for download of %v", job.URL)
+		return result
+	}
+
+	target := d.targetPath(*job)
+	partial := target + ".part"
+	result.Path = target
+
+	if !claimDownloadTarget(target) {
+		result.Err = fmt.Errorf("%v is already being downloaded", target)
+		return result
+	}
+	defer releaseDownloadTarget(target)
+
+	if err := os.MkdirAll(d.Dir, 0755); err != nil {
+		result.Err = err
+		return result
+	}
+
+	if expiry, ok := signedURLExpiry(job.URL); ok && time.Now().Add(urlExpiryMargin).After(expiry) {
+		if err := refreshDownloadURL(job); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	etag, err := d.fetch(job, partial, true)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if err = verifyChecksum(partial, job.Checksum, etag); err != nil {
+		removePartialDownload(partial)
+		result.Err = err
+		return result
+	}
+
+	if err = os.Rename(partial, target); err != nil {
+		logrus.WithField("path", target).Error("failed to move download into place")
+		result.Err = err
+		return result
+	}
+	os.Remove(partial + ".validator")
+
+	if stat, err := os.Stat(target); err == nil {
+		result.Size = stat.Size()
+	}
+	return result
+}
+
+// fetch downloads into the partial file. A partial file is only resumed when the ETag or
+// Last-Modified of its first response was saved next to it, and it is sent as If-Range so a
+// changed file is downloaded again from the start.
+func (d *Downloader) fetch(job *DownloadJob, partial string, canRefresh bool) (string, error) {
+	var offset int64
+	validator := readDownloadValidator(partial)
+	if stat, err := os.Stat(partial); err == nil && validator != "" {
+		offset = stat.Size()
+	}
+
+	req, err := http.NewRequest("GET", job.URL, nil)
+	if err != nil {
+		logrus.WithError(err).Error("failed to create download request")
+		return "", err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		logrus.WithError(err).WithField("file_name", job.FileName).Error("failed to do download request")
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var flags int
+	total := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		flags = os.O_WRONLY | os.O_APPEND
+		if total >= 0 {
+			total += offset
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		etag := strings.Trim(resp.Header.Get("ETag"), `"`)
+		if job.Checksum != "" || md5ETagPattern.MatchString(etag) {
+			logrus.WithField("file_name", job.FileName).Debug("partial download already complete")
+			return etag, nil
+		}
+		logrus.WithField("file_name", job.FileName).Info("partial download can not be verified, downloading it again")
+		removePartialDownload(partial)
+		return d.fetch(job, partial, canRefresh)
+	case (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusBadRequest) && canRefresh && job.Refresh != nil:
+		logrus.WithField("file_name", job.FileName).Info("download URL rejected, re-signing it")
+		if err = refreshDownloadURL(job); err != nil {
+			return "", err
+		}
+		return d.fetch(job, partial, false)
+	case resp.StatusCode >= 400:
+		return "", fmt.Errorf("download of %v failed with status %v", job.FileName, resp.StatusCode)
+	default:
+		offset = 0
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if err = writeDownloadValidator(partial, resp.Header); err != nil {
+			logrus.WithField("path", partial).Error("failed to save download validator")
+			return "", err
+		}
+	}
+
+	file, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		logrus.WithField("path", partial).Error("failed to open partial download")
+		return "", err
+	}
+	defer file.Close()
+
+	var body io.Reader = resp.Body
+	if d.Progress != nil {
+		body = &progressReader{reader: resp.Body, sent: offset, progress: func(received int64) {
+			d.Progress(*job, received, total)
+		}}
+	}
+	if _, err = io.Copy(file, body); err != nil {
+		logrus.WithError(err).WithField("file_name", job.FileName).Error("download interrupted")
+		return "", err
+	}
+
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+// writeDownloadValidator saves the strong ETag, or else the Last-Modified date, of a response
+// next to the partial file. Without either the partial file is not resumed.
+func writeDownloadValidator(partial string, header http.Header) error {
+	validator := header.Get("ETag")
+	if strings.HasPrefix(validator, "W/") {
+		validator = ""
+	}
+	if validator == "" {
+		validator = header.Get("Last-Modified")
+	}
+	if validator == "" {
+		os.Remove(partial + ".validator")
+		return nil
+	}
+	return ioutil.WriteFile(partial+".validator", []byte(validator), 0644)
+}
+
+func readDownloadValidator(partial string) string {
+	data, err := ioutil.ReadFile(partial + ".validator")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func removePartialDownload(partial string) {
+	os.Remove(partial)
+	os.Remove(partial + ".validator")
+}
+
+func refreshDownloadURL(job *DownloadJob) error {
+	if job.Refresh == nil {
+		return fmt.Errorf("download URL for %v has expired", job.FileName)
+	}
+
+	newURL, err := job.Refresh()
+	if err != nil {
+		logrus.WithField("file_name", job.FileName).Error("failed to re-sign download URL")
+		return err
+	}
+	job.URL = newURL
+	return nil
+}
+
+var md5ETagPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// verifyChecksum checks the file against the expected checksum, or against the ETag when it
+// is a plain MD5 as returned by S3 for single part objects.
+func verifyChecksum(filePath, checksum, etag string) error {
+	algorithm, expected := "", ""
+	if checksum != "" {
+		parts := strings.SplitN(checksum, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid checksum: %v", checksum)
+		}
+		algorithm, expected = strings.ToLower(parts[0]), strings.ToLower(parts[1])
+	} else if md5ETagPattern.MatchString(etag) {
+		algorithm, expected = "md5", etag
+	} else {
+		return nil
+	}
+
+	var h hash.Hash
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return fmt.Errorf("unsupported checksum algorithm: %v", algorithm)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = io.Copy(h, file); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch for %v: expected %v, got %v", strings.TrimSuffix(filepath.Base(filePath), ".part"), expected, actual)
+	}
+	return nil
+}
+
+// signedURLExpiry reads the expiry of a signed S3 or CloudFront URL.
+func signedURLExpiry(signedURL string) (time.Time, bool) {
+	parsed, err := url.Parse(signedURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+	q := parsed.Query()
+
+	if date, expires := q.Get("X-Amz-Date"), q.Get("X-Amz-Expires"); date != "" && expires != "" {
+		signedAt, err := time.Parse("20060102T150405Z", date)
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds, err := strconv.Atoi(expires)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return signedAt.Add(time.Duration(seconds) * time.Second), true
+	}
+
+	if expires := q.Get("Expires"); expires != "" {
+		seconds, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(seconds, 0), true
+	}
+
+	return time.Time{}, false
+}
+
+// fileNameFromURL uses the file name of the response-content-disposition of a signed URL, or
+// the last element of its path.
+func fileNameFromURL(signedURL string) string {
+	parsed, err := url.Parse(signedURL)
+	if err != nil {
+		return ""
+	}
+
+	if disposition := parsed.Query().Get("response-content-disposition"); disposition != "" {
+		if _, params, err := mime.ParseMediaType(disposition); err == nil && params["filename"] != "" {
+			return params["filename"]
+		}
+		if strings.HasPrefix(disposition, "filename=") {
+			return strings.Trim(strings.TrimPrefix(disposition, "filename="), `"`)
+		}
+	}
+
+	name := path.Base(parsed.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
+
+func NewAttachmentDownload(attachmentID int64) (*DownloadJob, error) {
+	attachment, err := GetAttachmentFromID(attachmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DownloadJob{
+		URL:      attachment.FileURL,
+		FileName: attachment.Name,
+		Refresh: func() (string, error) {
+			attachment, err := GetAttachmentFromID(attachmentID)
+			if err != nil {
+				return "", err
+			}
+			return attachment.FileURL, nil
+		},
+	}, nil
+}
+
+func NewVersionMovieDownload(versionID int64) (*DownloadJob, error) {
+	version, err := GetVersionForID(versionID)
+	if err != nil {
+		return nil, err
+	}
+	if version.MovieURL == "" {
+		return nil, fmt.Errorf("Version %v has no uploaded movie", versionID)
+	}
+
+	return &DownloadJob{
+		URL:      version.MovieURL,
+		FileName: fileNameFromURL(version.MovieURL),
+		Refresh: func() (string, error) {
+			version, err := GetVersionForID(versionID)
+			if err != nil {
+				return "", err
+			}
+			return version.MovieURL, nil
+		},
+	}, nil
+}
+
+func NewThumbnailDownload(entityType string, entityID int64) (*DownloadJob, error) {
+	service := NewThumbnailService()
+	thumbnail, err := service.Resolve(entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	switch thumbnail.Status {
+	case ThumbnailMissing:
+		return nil, fmt.Errorf("%v %v has no thumbnail", entityType, entityID)
+	case ThumbnailPending:
+		return nil, fmt.Errorf("thumbnail of %v %v is still being transcoded", entityType, entityID)
+	}
+
+	fileName := fileNameFromURL(thumbnail.URL)
+	if ext := filepath.Ext(fileName); ext != "" {
+		fileName = fmt.Sprintf("%v_%v_thumbnail%v", entityType, entityID, ext)
+	}
+
+	return &DownloadJob{
+		URL:      thumbnail.URL,
+		FileName: fileName,
+		Refresh: func() (string, error) {
+			service.Invalidate(entityType, entityID)
+			thumbnail, err := service.Resolve(entityType, entityID)
+			if err != nil {
+				return "", err
+			}
+			if thumbnail.Status != ThumbnailReady {
+				return "", fmt.Errorf("thumbnail of %v %v is no longer available", entityType, entityID)
+			}
+			return thumbnail.URL, nil
+		},
+	}, nil
+}
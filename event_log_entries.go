@@ -12,6 +12,13 @@ type EventData struct {
 	Metadata    map[string]interface{} `json:"meta,omitempty"`
 	Entity      LinkField              `json:"entity"`
 	Project     LinkField              `json:"project"`
+	CreatedAt   string                 `json:"created_at,omitempty"`
+}
+
+var eventFields = []string{
+	"id", "event_type", "project",
+	"entity", "description", "meta",
+	"created_at",
 }
 
 type EventRecord struct {
@@ -20,6 +27,7 @@ type EventRecord struct {
 		EventType   string                 `json:"event_type"`
 		Description string                 `json:"description"`
 		Metadata    map[string]interface{} `json:"meta,omitempty"`
+		CreatedAt   string                 `json:"created_at"`
 	} `json:"attributes"`
 	Relationships struct {
 		Entity struct {
@@ -87,11 +95,6 @@ func GetNewEvents(lastEventID int64) ([]EventData, error) {
 		)
 	}
 
-	fields := []string{
-		"id", "event_type", "project",
-		"entity", "description", "meta",
-	}
-
 	var sort []SortParam
 	if lastEventID > 0 {
 		sort = []SortParam{
@@ -122,7 +125,7 @@ func GetNewEvents(lastEventID int64) ([]EventData, error) {
 		}
 	}
 
-	req, err := NewSearchRequest("EventLogEntry", filters, fields, &page, sort)
+	req, err := NewSearchRequest("EventLogEntry", filters, eventFields, &page, sort)
 	if err != nil {
 		logrus.Error("failed to create EventLogEntry search request")
 		return nil, err
@@ -136,18 +139,42 @@ func GetNewEvents(lastEventID int64) ([]EventData, error) {
 
 	var result []EventData
 	for _, record := range resp.Data {
-		eventID := record.ID
-		event := EventData{
-			ID:          &eventID,
-			EventType:   record.Attributes.EventType,
-			Description: record.Attributes.Description,
-			Project:     record.Relationships.Project.Data,
-			Entity:      record.Relationships.Entity.Data,
-			Metadata:    record.Attributes.Metadata,
-		}
-
-		result = append(result, event)
+		result = append(result, newEventData(record))
 	}
 
 	return result, nil
 }
+
+func newEventData(record EventRecord) EventData {
+	eventID := record.ID
+	return EventData{
+		ID:          &eventID,
+		EventType:   record.Attributes.EventType,
+		Description: record.Attributes.Description,
+		Project:     record.Relationships.Project.Data,
+		Entity:      record.Relationships.Entity.Data,
+		Metadata:    record.Attributes.Metadata,
+		CreatedAt:   record.Attributes.CreatedAt,
+	}
+}
+
+// ProcessNewEvents hands every event after lastEventID to the plugins and returns the ID of
+// the last event processed, which the caller passes back in on the next poll.
+func ProcessNewEvents(lastEventID int64, plugins []EventPlugin) (int64, error) {
+	events, err := GetNewEvents(lastEventID)
+	if err != nil {
+		return lastEventID, err
+	}
+
+	opts := ReplayOptions{Plugins: plugins}
+	for _, event := range events {
+		if lastEventID > 0 {
+			if err = dispatchEvent(event, opts); err != nil {
+				logrus.WithError(err).Error("failed to process event")
+			}
+		}
+		lastEventID = *event.ID
+	}
+
+	return lastEventID, nil
+}
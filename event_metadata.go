@@ -0,0 +1,176 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+type EventAction string
+
+const (
+	NewEventAction        EventAction = "New"
+	ChangeEventAction     EventAction = "Change"
+	RetirementEventAction EventAction = "Retirement"
+	RevivalEventAction    EventAction = "Revival"
+)
+
+type EventMetadataType string
+
+const (
+	AttributeChangeMetadata  EventMetadataType = "attribute_change"
+	EntityCreationMetadata   EventMetadataType = "new_entity"
+	EntityRetirementMetadata EventMetadataType = "entity_retirement"
+	EntityRevivalMetadata    EventMetadataType = "entity_revival"
+)
+
+// AttributeChange is the metadata of a Shotgun_<Entity>_Change event for a single value field.
+type AttributeChange struct {
+	Type          EventMetadataType `json:"type"`
+	EntityType    string            `json:"entity_type"`
+	EntityID      int64             `json:"entity_id"`
+	FieldName     string            `json:"attribute_name"`
+	FieldDataType string            `json:"field_data_type"`
+	InCreate      bool              `json:"in_create"`
+	Old           interface{}       `json:"old_value"`
+	New           interface{}       `json:"new_value"`
+}
+
+// MultiEntityChange is the metadata of a Shotgun_<Entity>_Change event for a multi_entity field.
+type MultiEntityChange struct {
+	Type          EventMetadataType `json:"type"`
+	EntityType    string            `json:"entity_type"`
+	EntityID      int64             `json:"entity_id"`
+	FieldName     string            `json:"attribute_name"`
+	FieldDataType string            `json:"field_data_type"`
+	InCreate      bool              `json:"in_create"`
+	Added         []LinkField       `json:"added"`
+	Removed       []LinkField       `json:"removed"`
+}
+
+type EntityCreation struct {
+	Type       EventMetadataType `json:"type"`
+	EntityType string            `json:"entity_type"`
+	EntityID   int64             `json:"entity_id"`
+}
+
+type EntityRetirement struct {
+	Type           EventMetadataType `json:"type"`
+	EntityType     string            `json:"entity_type"`
+	EntityID       int64             `json:"entity_id"`
+	ClassName      string            `json:"class_name"`
+	RetirementDate string            `json:"retirement_date"`
+}
+
+type EntityRevival struct {
+	Type       EventMetadataType `json:"type"`
+	EntityType string            `json:"entity_type"`
+	EntityID   int64             `json:"entity_id"`
+	ClassName  string            `json:"class_name"`
+}
+
+// ParseEventType splits a Shotgun event type like Shotgun_Version_Change into its
+// entity type and action. Events not generated by Shotgun itself return ok as false.
+func (e *EventData) ParseEventType() (entityType string, action EventAction, ok bool) {
+	parts := strings.Split(e.EventType, "_")
+	if len(parts) < 3 || parts[0] != "Shotgun" {
+		return "", "", false
+	}
+	entityType = strings.Join(parts[1:len(parts)-1], "_")
+	action = EventAction(parts[len(parts)-1])
+	return entityType, action, true
+}
+
+// DecodeMetadata returns the typed metadata for the event, selected by its event type.
+// The result is one of *AttributeChange, *MultiEntityChange, *EntityCreation,
+// *EntityRetirement or *EntityRevival.
+func (e *EventData) DecodeMetadata() (interface{}, error) {
+	_, action, ok := e.ParseEventType()
+	if !ok {
+		return nil, fmt.Errorf("event type %v has no known metadata format", e.EventType)
+	}
+
+	var result interface{}
+	switch action {
+	case ChangeEventAction:
+		if fieldType, _ := e.Metadata["field_data_type"].(string); fieldType == "multi_entity" {
+			result = &MultiEntityChange{}
+		} else {
+			result = &AttributeChange{}
+		}
+	case NewEventAction:
+		result = &EntityCreation{}
+	case RetirementEventAction:
+		result = &EntityRetirement{}
+	case RevivalEventAction:
+		result = &EntityRevival{}
+	default:
+		return nil, fmt.Errorf("event type %v has no known metadata format", e.EventType)
+	}
+
+	if err := e.decodeMetadataInto(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *EventData) decodeMetadataInto(v interface{}) error {
+	jsonStr, err := json.Marshal(e.Metadata)
+	if err != nil {
+		logrus.WithError(err).Error("failed to marshal EventLogEntry metadata")
+		return err
+	}
+	if err = json.Unmarshal(jsonStr, v); err != nil {
+		logrus.WithError(err).Error("failed to unmarshal EventLogEntry metadata")
+		return err
+	}
+	return nil
+}
+
+// AttributeChange returns the metadata of a single value field change, or nil if the
+// event is not one.
+func (e *EventData) AttributeChange() *AttributeChange {
+	meta, err := e.DecodeMetadata()
+	if err != nil {
+		return nil
+	}
+	change, _ := meta.(*AttributeChange)
+	return change
+}
+
+// MultiEntityChange returns the metadata of a multi_entity field change, or nil if the
+// event is not one.
+func (e *EventData) MultiEntityChange() *MultiEntityChange {
+	meta, err := e.DecodeMetadata()
+	if err != nil {
+		return nil
+	}
+	change, _ := meta.(*MultiEntityChange)
+	return change
+}
+
+// ChangedField returns the name of the field changed by the event, or "" if the event
+// is not a field change.
+func (e *EventData) ChangedField() string {
+	_, action, ok := e.ParseEventType()
+	if !ok || action != ChangeEventAction {
+		return ""
+	}
+	fieldName, _ := e.Metadata["attribute_name"].(string)
+	return fieldName
+}
+
+func (e *EventData) IsFieldChange(fieldName string) bool {
+	return fieldName != "" && e.ChangedField() == fieldName
+}
+
+func (e *EventData) IsEntityCreation() bool {
+	_, action, ok := e.ParseEventType()
+	return ok && action == NewEventAction
+}
+
+func (e *EventData) IsEntityRetirement() bool {
+	_, action, ok := e.ParseEventType()
+	return ok && action == RetirementEventAction
+}
@@ -0,0 +1,185 @@
+package shotgun_api
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// EventPlugin is implemented by anything that reacts to EventLogEntry records, whether they
+// come from polling GetNewEvents or from a replay. When dryRun is true the plugin must not
+// write anything back to Shotgun.
+type EventPlugin interface {
+	Name() string
+	HandleEvent(event EventData, dryRun bool) error
+}
+
+type ReplayOptions struct {
+	PageSize        int           // Number of events fetched per search request, defaults to 100.
+	DryRun          bool          // Passed through to every plugin.
+	StopOnError     bool          // Abort the replay on the first plugin error instead of continuing.
+	Plugins         []EventPlugin // Plugins that receive each event in ascending ID order.
+	EventTypes      []string      // Only replay these event types when set.
+	ProjectID       int64         // Only replay events for this Project when set.
+	OnEventReplayed func(event EventData)
+}
+
+type ReplayResult struct {
+	Count       int64   `json:"count"`
+	LastEventID int64   `json:"last_event_id"`
+	Errors      []error `json:"-"`
+}
+
+func (o *ReplayOptions) pageSize() int {
+	if o.PageSize <= 0 {
+		return 100
+	}
+	return o.PageSize
+}
+
+// ReplayEvents re-runs the plugins over every event with an ID in [fromID, toID]. A toID
+// of zero replays up to the latest event.
+func ReplayEvents(fromID, toID int64, opts ReplayOptions) (*ReplayResult, error) {
+	if toID > 0 && toID < fromID {
+		return nil, fmt.Errorf("invalid event range: %v > %v", fromID, toID)
+	}
+
+	var filters ShotgunFilters
+	if toID > 0 {
+		filters.Expressions = append(filters.Expressions,
+			ShotgunFilterExpression{"id", "less_than", toID + 1},
+		)
+	}
+
+	return replayEvents(fromID-1, filters, opts, nil)
+}
+
+// ReplayEventsSince re-runs the plugins over every event created at or after since. Shotgun
+// stores created_at to the second, so since is compared at that precision.
+func ReplayEventsSince(since time.Time, opts ReplayOptions) (*ReplayResult, error) {
+	since = since.Truncate(time.Second)
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"created_at", "greater_than", since.Add(-time.Second).UTC().Format(time.RFC3339)},
+		},
+	}
+
+	// The filter reaches a second back to cover the rounding of created_at, the events of that
+	// second before since are dropped here so they are not replayed twice.
+	include := func(event EventData) bool {
+		createdAt, err := time.Parse(time.RFC3339, event.CreatedAt)
+		if err != nil {
+			logrus.WithField("created_at", event.CreatedAt).Warn("failed to parse event creation time")
+			return true
+		}
+		return !createdAt.Before(since)
+	}
+
+	return replayEvents(0, filters, opts, include)
+}
+
+// replayEvents dispatches the events after afterID matching the filters. Events rejected by
+// include, when set, are skipped but still move LastEventID forward.
+func replayEvents(afterID int64, filters ShotgunFilters, opts ReplayOptions, include func(EventData) bool) (*ReplayResult, error) {
+	if len(opts.EventTypes) > 0 {
+		filters.Expressions = append(filters.Expressions,
+			ShotgunFilterExpression{"event_type", "in", opts.EventTypes},
+		)
+	}
+	if opts.ProjectID > 0 {
+		filters.Expressions = append(filters.Expressions,
+			ShotgunFilterExpression{"project.Project.id", "is", opts.ProjectID},
+		)
+	}
+
+	result := &ReplayResult{LastEventID: afterID}
+	for {
+		events, err := getEventPage(result.LastEventID, filters, opts.pageSize())
+		if err != nil {
+			return result, err
+		}
+
+		for _, event := range events {
+			if include != nil && !include(event) {
+				result.LastEventID = *event.ID
+				continue
+			}
+			if err = dispatchEvent(event, opts); err != nil {
+				result.Errors = append(result.Errors, err)
+				if opts.StopOnError {
+					return result, err
+				}
+			}
+			result.Count++
+			result.LastEventID = *event.ID
+			if opts.OnEventReplayed != nil {
+				opts.OnEventReplayed(event)
+			}
+		}
+
+		if len(events) < opts.pageSize() {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// getEventPage pages by ID rather than page number, so events created while a replay is
+// running can not shift the window.
+func getEventPage(afterID int64, filters ShotgunFilters, pageSize int) ([]EventData, error) {
+	pageFilters := ShotgunFilters{
+		Expressions: append([]ShotgunFilterExpression{
+			{"id", "greater_than", afterID},
+		}, filters.Expressions...),
+	}
+	sort := []SortParam{
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+	page := PageParam{
+		Size: pageSize,
+	}
+
+	req, err := NewSearchRequest("EventLogEntry", pageFilters, eventFields, &page, sort)
+	if err != nil {
+		logrus.Error("failed to create EventLogEntry search request")
+		return nil, err
+	}
+
+	var resp EventMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make EventLogEntry search request")
+		return nil, err
+	}
+
+	var result []EventData
+	for _, record := range resp.Data {
+		result = append(result, newEventData(record))
+	}
+
+	return result, nil
+}
+
+func dispatchEvent(event EventData, opts ReplayOptions) error {
+	var failed []string
+	for _, plugin := range opts.Plugins {
+		if err := plugin.HandleEvent(event, opts.DryRun); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"plugin":   plugin.Name(),
+				"event_id": *event.ID,
+			}).Error("plugin failed to handle event")
+			failed = append(failed, fmt.Sprintf("%v: %v", plugin.Name(), err))
+			if opts.StopOnError {
+				break
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("event %v: %v", *event.ID, failed)
+	}
+	return nil
+}
@@ -3,18 +3,15 @@ package shotgun_api
 import (
 	"encoding/json"
 	"github.com/sirupsen/logrus"
-	"runtime"
 )
 
 func GetPlatformProjectsPath() string {
-	switch runtime.GOOS {
-	case "windows":
-		return "O:\\projects"
-	case "darwin":
-		return "/Volumes/prod/projects"
-	default:
-		return "/prod/projects"
+	rootPath, err := PathTemplates.RootPath("", PrimaryStorageRoot)
+	if err != nil {
+		logrus.WithError(err).Warn("falling back to default projects root")
+		return DefaultPathTemplateConfig().Roots[PrimaryStorageRoot].Path()
 	}
+	return rootPath
 }
 
 var attachmentFields = []string{
@@ -49,6 +46,62 @@ func (e *AttachmentRecordResponse) ReadRecord(data []byte) error {
 	return nil
 }
 
+type AttachmentMultiRecordResponse struct {
+	Data []AttachmentRecord `json:"data"`
+}
+
+func (t *AttachmentMultiRecordResponse) ReadRecord(data []byte) error {
+	err := json.Unmarshal(data, &t)
+	if err != nil {
+		logrus.Error("failed to unmarshal data to AttachmentMultiRecord")
+		return err
+	}
+	return nil
+}
+
+const maxSearchPageSize = 500
+
+// GetAttachmentsForIDs resolves many Attachments with one search request per 500 IDs.
+func GetAttachmentsForIDs(attachmentIDs []int64) ([]AttachmentData, error) {
+	var result []AttachmentData
+	for start := 0; start < len(attachmentIDs); start += maxSearchPageSize {
+		end := start + maxSearchPageSize
+		if end > len(attachmentIDs) {
+			end = len(attachmentIDs)
+		}
+
+		filters := ShotgunFilters{
+			Expressions: []ShotgunFilterExpression{
+				{"id", "in", attachmentIDs[start:end]},
+			},
+		}
+		page := PageParam{
+			Size: maxSearchPageSize,
+		}
+		req, err := NewSearchRequest("Attachment", filters, attachmentFields, &page, nil)
+		if err != nil {
+			logrus.Error("failed to create Attachment search request")
+			return nil, err
+		}
+
+		var resp AttachmentMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make Attachment search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, AttachmentData{
+				ID:      record.ID,
+				Name:    record.Attributes.Name,
+				FileURL: record.Attributes.File.URL,
+			})
+		}
+	}
+
+	return result, nil
+}
+
 func GetAttachmentFromID(attachmentID int64) (*AttachmentData, error) {
 	req, err := NewFindRequest("Attachment", attachmentID, attachmentFields)
 	if err != nil {
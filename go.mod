@@ -2,4 +2,7 @@ module github.com/ricksilliker/shotgun-go
 
 go 1.15
 
-require github.com/sirupsen/logrus v1.8.1
+require (
+	github.com/sirupsen/logrus v1.8.1
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -1,11 +1,16 @@
 package shotgun_api
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 func NewThumbnailRequest(entityID int64, entityType, fieldName string) (*http.Request, error) {
@@ -23,7 +28,7 @@ func NewThumbnailRequest(entityID int64, entityType, fieldName string) (*http.Re
 }
 
 type GetThumbnailResponse struct {
-	Data string `json:"data"`
+	Data *string `json:"data"`
 }
 
 func DoGetThumbnail(req *http.Request) (string, error) {
@@ -42,6 +47,10 @@ func DoGetThumbnail(req *http.Request) (string, error) {
 		return "", err
 	}
 
+	if resp.StatusCode >= 400 {
+		return "", HandleError(resp)
+	}
+
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		logrus.WithError(err).Error("failed to read GET thumbnail response")
@@ -54,9 +63,14 @@ func DoGetThumbnail(req *http.Request) (string, error) {
 		return "", err
 	}
 
-	return thumbnailResp.Data, nil
+	if thumbnailResp.Data == nil {
+		return "", nil
+	}
+	return *thumbnailResp.Data, nil
 }
 
+// GetThumbnailURL returns "" when the entity has no thumbnail or the lookup fails. Use a
+// ThumbnailService to tell those cases apart.
 func GetThumbnailURL(entityID int64, entityType, fieldName string) string {
 	req, err := NewThumbnailRequest(entityID, entityType, fieldName)
 	if err != nil {
@@ -65,8 +79,94 @@ func GetThumbnailURL(entityID int64, entityType, fieldName string) string {
 
 	url, err := DoGetThumbnail(req)
 	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"entity_type": entityType,
+			"entity_id":   entityID,
+		}).Warn("failed to get thumbnail URL")
 		return ""
 	}
 
 	return url
 }
+
+const (
+	ThumbnailField = "image"
+	FilmstripField = "filmstrip_image"
+)
+
+func UploadThumbnail(entityType string, entityID int64, r io.Reader, fileName string) error {
+	return uploadImage(entityType, entityID, ThumbnailField, r, fileName)
+}
+
+func UploadThumbnailFile(entityType string, entityID int64, filePath string) error {
+	return uploadImageFile(entityType, entityID, ThumbnailField, filePath)
+}
+
+// UploadFilmstrip uploads a filmstrip, a single image made of equally sized frames laid out
+// horizontally, used by Shotgun to scrub through the thumbnail.
+func UploadFilmstrip(entityType string, entityID int64, r io.Reader, fileName string) error {
+	return uploadImage(entityType, entityID, FilmstripField, r, fileName)
+}
+
+func UploadFilmstripFile(entityType string, entityID int64, filePath string) error {
+	return uploadImageFile(entityType, entityID, FilmstripField, filePath)
+}
+
+func uploadImageFile(entityType string, entityID int64, fieldName, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		logrus.WithField("path", filePath).Error("failed to open image for upload")
+		return err
+	}
+	defer file.Close()
+
+	return uploadImage(entityType, entityID, fieldName, file, filepath.Base(filePath))
+}
+
+func uploadImage(entityType string, entityID int64, fieldName string, r io.Reader, fileName string) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		logrus.WithError(err).Error("failed to read image for upload")
+		return err
+	}
+
+	contentType := detectContentType(fileName, data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return fmt.Errorf("%v is not an image: %v", fileName, contentType)
+	}
+
+	if err = uploadReader(entityType, entityID, fieldName, fileName, contentType, bytes.NewReader(data), int64(len(data)), UploadOptions{}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"entity_type": entityType,
+			"entity_id":   entityID,
+			"field_name":  fieldName,
+		}).Error("failed to upload image")
+		return err
+	}
+	return nil
+}
+
+// imageContentTypes are the image formats Shotgun transcodes but that are neither sniffed by
+// http.DetectContentType nor always known to the mime package.
+var imageContentTypes = map[string]string{
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".exr":  "image/x-exr",
+	".dpx":  "image/x-dpx",
+	".tga":  "image/x-tga",
+	".psd":  "image/vnd.adobe.photoshop",
+	".hdr":  "image/vnd.radiance",
+}
+
+// detectContentType sniffs the content, falling back to the file extension when the content
+// is not recognised.
+func detectContentType(fileName string, data []byte) string {
+	contentType := http.DetectContentType(data)
+	if contentType == "application/octet-stream" || strings.HasPrefix(contentType, "text/plain") {
+		if imageType, ok := imageContentTypes[strings.ToLower(filepath.Ext(fileName))]; ok {
+			return imageType
+		}
+		return contentTypeForFile(fileName)
+	}
+	return contentType
+}
@@ -0,0 +1,150 @@
+package shotgun_api
+
+import (
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+// mentionPattern matches @login and @"Group Name". The mention must not follow a word
+// character, so e-mail addresses are not mistaken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(?:"([^"]+)"|([\w][\w.\-]*[\w]|[\w]))`)
+
+type Mention struct {
+	Text   string     `json:"text"`   // The mention as written, including the @.
+	Name   string     `json:"name"`   // The login or group name.
+	Start  int        `json:"start"`  // Byte offset of the @ in the body.
+	End    int        `json:"end"`    // Byte offset just after the mention.
+	Entity *LinkField `json:"entity"` // The HumanUser or Group, nil until resolved.
+}
+
+// ParseMentions finds the @mentions in a note body, in the order they are written.
+func ParseMentions(body string) []Mention {
+	var result []Mention
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(body, -1) {
+		nameStart, nameEnd := match[2], match[3]
+		if nameStart < 0 {
+			nameStart, nameEnd = match[4], match[5]
+		}
+
+		start := strings.LastIndex(body[:nameStart], "@")
+		result = append(result, Mention{
+			Text:  body[start:match[1]],
+			Name:  body[nameStart:nameEnd],
+			Start: start,
+			End:   match[1],
+		})
+	}
+	return result
+}
+
+// ResolveMentions looks up the HumanUser or, failing that, the Group each mention refers to.
+// Mentions that match neither are returned with a nil Entity.
+func ResolveMentions(mentions []Mention) ([]Mention, error) {
+	var names []string
+	for _, mention := range mentions {
+		if !containsString(names, mention.Name) {
+			names = append(names, mention.Name)
+		}
+	}
+	if len(names) == 0 {
+		return mentions, nil
+	}
+
+	resolved := map[string]LinkField{}
+	users, err := GetShotgunUsersByLogins(names)
+	if err != nil {
+		logrus.Error("failed to resolve mentioned users")
+		return nil, err
+	}
+	for _, user := range users {
+		resolved[strings.ToLower(user.Login)] = user.Link()
+	}
+
+	var groupNames []string
+	for _, name := range names {
+		if _, ok := resolved[strings.ToLower(name)]; !ok {
+			groupNames = append(groupNames, name)
+		}
+	}
+	groups, err := GetGroupsByNames(groupNames)
+	if err != nil {
+		logrus.Error("failed to resolve mentioned groups")
+		return nil, err
+	}
+	for _, group := range groups {
+		if _, ok := resolved[strings.ToLower(group.Name)]; !ok {
+			resolved[strings.ToLower(group.Name)] = group
+		}
+	}
+
+	result := make([]Mention, len(mentions))
+	for i, mention := range mentions {
+		result[i] = mention
+		if entity, ok := resolved[strings.ToLower(mention.Name)]; ok {
+			result[i].Entity = &entity
+		} else {
+			logrus.WithField("mention", mention.Text).Warn("mention does not match a user or group")
+		}
+	}
+	return result, nil
+}
+
+// MentionedEntities returns the distinct users and groups of resolved mentions.
+func MentionedEntities(mentions []Mention) []LinkField {
+	var result []LinkField
+	for _, mention := range mentions {
+		if mention.Entity != nil && !containsLink(result, *mention.Entity) {
+			result = append(result, *mention.Entity)
+		}
+	}
+	return result
+}
+
+// RenderMentions replaces resolved mentions with the display name of their user or group,
+// e.g. "@jdoe" becomes "@John Doe". Unresolved mentions are left as written.
+func RenderMentions(body string, mentions []Mention) string {
+	return RenderMentionsFunc(body, mentions, func(mention Mention) string {
+		return "@" + mention.Entity.Name
+	})
+}
+
+// RenderMentionsFunc replaces every resolved mention with the result of render, e.g. to build
+// links to the user pages.
+func RenderMentionsFunc(body string, mentions []Mention, render func(mention Mention) string) string {
+	var builder strings.Builder
+	last := 0
+	for _, mention := range mentions {
+		if mention.Entity == nil || mention.Start < last || mention.End > len(body) {
+			continue
+		}
+		builder.WriteString(body[last:mention.Start])
+		builder.WriteString(render(mention))
+		last = mention.End
+	}
+	builder.WriteString(body[last:])
+	return builder.String()
+}
+
+// Mentions parses and resolves the mentions in the body of the note.
+func (n *NoteData) Mentions() ([]Mention, error) {
+	return ResolveMentions(ParseMentions(n.Body))
+}
+
+func containsString(items []string, item string) bool {
+	for _, value := range items {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+func containsLink(links []LinkField, link LinkField) bool {
+	for _, value := range links {
+		if value.ID == link.ID && value.Type == link.Type {
+			return true
+		}
+	}
+	return false
+}
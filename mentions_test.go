@@ -0,0 +1,81 @@
+package shotgun_api
+
+import (
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Mention
+	}{
+		{
+			name: "login",
+			body: "@jdoe please check",
+			want: []Mention{{Text: "@jdoe", Name: "jdoe", Start: 0, End: 5}},
+		},
+		{
+			name: "quoted group",
+			body: `cc @"Comp Leads" for review`,
+			want: []Mention{{Text: `@"Comp Leads"`, Name: "Comp Leads", Start: 3, End: 16}},
+		},
+		{
+			name: "login with dots and dashes",
+			body: "thanks @jane.doe-2!",
+			want: []Mention{{Text: "@jane.doe-2", Name: "jane.doe-2", Start: 7, End: 18}},
+		},
+		{
+			name: "trailing punctuation is not part of the login",
+			body: "ask @jdoe.",
+			want: []Mention{{Text: "@jdoe", Name: "jdoe", Start: 4, End: 9}},
+		},
+		{
+			name: "single character login",
+			body: "@a",
+			want: []Mention{{Text: "@a", Name: "a", Start: 0, End: 2}},
+		},
+		{
+			name: "several mentions in order",
+			body: "@jdoe and @asmith,@\"FX Team\"",
+			want: []Mention{
+				{Text: "@jdoe", Name: "jdoe", Start: 0, End: 5},
+				{Text: "@asmith", Name: "asmith", Start: 10, End: 17},
+				{Text: `@"FX Team"`, Name: "FX Team", Start: 18, End: 28},
+			},
+		},
+		{
+			name: "e-mail address",
+			body: "mail jdoe@example.com",
+			want: nil,
+		},
+		{
+			name: "double at",
+			body: "@@jdoe",
+			want: nil,
+		},
+		{
+			name: "lone at",
+			body: "meet @ noon",
+			want: nil,
+		},
+		{
+			name: "unterminated quote",
+			body: `@"Comp Leads`,
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ParseMentions(test.body)
+			if len(got) != len(test.want) {
+				t.Fatalf("ParseMentions(%q) = %+v, want %+v", test.body, got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("ParseMentions(%q)[%v] = %+v, want %+v", test.body, i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
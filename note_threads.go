@@ -0,0 +1,244 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type ReplyData struct {
+	ID        int64     `json:"id"`
+	Note      LinkField `json:"note"`
+	Body      string    `json:"body"`
+	Author    LinkField `json:"author"`
+	CreatedAt string    `json:"created_at"`
+}
+
+type ReplyRecord struct {
+	ID         int64 `json:"id"`
+	Attributes struct {
+		Body      string `json:"content"`
+		CreatedAt string `json:"created_at"`
+	} `json:"attributes"`
+	Relationships struct {
+		Entity struct {
+			Data LinkField `json:"data"`
+		} `json:"entity"`
+		Author struct {
+			Data LinkField `json:"data"`
+		} `json:"user"`
+	} `json:"relationships"`
+}
+
+type ReplyRecordResponse struct {
+	Data ReplyRecord `json:"data"`
+}
+
+func (e *ReplyRecordResponse) ReadRecord(data []byte) error {
+	if err := json.Unmarshal(data, &e); err != nil {
+		logrus.Error("failed to unmarshal Reply response")
+		return err
+	}
+	return nil
+}
+
+// NoteThreadItem is one entry of a note thread: the note itself, a Reply or an Attachment.
+type NoteThreadItem struct {
+	Type       string          `json:"type"`
+	ID         int64           `json:"id"`
+	Body       string          `json:"body"`
+	Author     LinkField       `json:"author"`
+	CreatedAt  string          `json:"created_at"`
+	Attachment *AttachmentData `json:"attachment,omitempty"`
+}
+
+type NoteThread struct {
+	Note        NoteData         `json:"note"`
+	Items       []NoteThreadItem `json:"items"` // The note, its Replies and Attachments in chronological order.
+	Replies     []ReplyData      `json:"replies"`
+	Attachments []AttachmentData `json:"attachments"`
+}
+
+var noteThreadFields = map[string][]string{
+	"Note":       {"subject", "content", "created_at", "user"},
+	"Reply":      {"content", "created_at", "user"},
+	"Attachment": {"this_file", "name", "created_at", "created_by"},
+}
+
+type noteThreadRecord struct {
+	Type      string    `json:"type"`
+	ID        int64     `json:"id"`
+	Content   string    `json:"content"`
+	CreatedAt string    `json:"created_at"`
+	User      LinkField `json:"user"`
+	CreatedBy LinkField `json:"created_by"`
+}
+
+type noteThreadResponse struct {
+	Data []noteThreadRecord `json:"data"`
+}
+
+// GetNoteThread returns a note with its Replies and Attachments, using the thread_contents
+// endpoint.
+func GetNoteThread(noteID int64) (*NoteThread, error) {
+	note, err := GetNoteForID(noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := getNoteThreadContents(noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachmentIDs []int64
+	for _, record := range records {
+		if record.Type == "Attachment" {
+			attachmentIDs = append(attachmentIDs, record.ID)
+		}
+	}
+	attachments := map[int64]AttachmentData{}
+	if len(attachmentIDs) > 0 {
+		resolved, err := GetAttachmentsForIDs(attachmentIDs)
+		if err != nil {
+			logrus.WithField("note_id", noteID).Error("failed to retrieve Note thread attachments")
+			return nil, err
+		}
+		for _, attachment := range resolved {
+			attachments[attachment.ID] = attachment
+		}
+	}
+
+	thread := &NoteThread{Note: *note}
+	noteLink := LinkField{ID: noteID, Type: "Note"}
+	for _, record := range records {
+		item := NoteThreadItem{
+			Type:      record.Type,
+			ID:        record.ID,
+			Body:      record.Content,
+			Author:    record.User,
+			CreatedAt: record.CreatedAt,
+		}
+
+		switch record.Type {
+		case "Reply":
+			thread.Replies = append(thread.Replies, ReplyData{
+				ID:        record.ID,
+				Note:      noteLink,
+				Body:      record.Content,
+				Author:    record.User,
+				CreatedAt: record.CreatedAt,
+			})
+		case "Attachment":
+			item.Author = record.CreatedBy
+			if attachment, ok := attachments[record.ID]; ok {
+				item.Attachment = &attachment
+				thread.Attachments = append(thread.Attachments, attachment)
+			}
+		}
+
+		thread.Items = append(thread.Items, item)
+	}
+
+	sort.SliceStable(thread.Items, func(i, j int) bool {
+		return thread.Items[i].CreatedAt < thread.Items[j].CreatedAt
+	})
+	sort.SliceStable(thread.Replies, func(i, j int) bool {
+		return thread.Replies[i].CreatedAt < thread.Replies[j].CreatedAt
+	})
+
+	return thread, nil
+}
+
+func getNoteThreadContents(noteID int64) ([]noteThreadRecord, error) {
+	threadURL := ShotgunURL + fmt.Sprintf("/entity/notes/%v/thread_contents", noteID)
+	req, err := http.NewRequest("GET", threadURL, nil)
+	if err != nil {
+		logrus.Error("failed to create get thread_contents request")
+		return nil, err
+	}
+	q := req.URL.Query()
+	for entityType, fields := range noteThreadFields {
+		q.Add(fmt.Sprintf("entity_fields[%v]", entityType), strings.Join(fields, ","))
+	}
+	req.URL.RawQuery = q.Encode()
+
+	auth, err := AuthenticateShotgunScript()
+	if err != nil {
+		logrus.Error("failed to authorize script")
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Authorization", fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken))
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		logrus.Error("failed to do get thread_contents request")
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, HandleError(resp)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logrus.Error("failed to read response body for get thread_contents request")
+		return nil, err
+	}
+
+	var thread noteThreadResponse
+	if err = json.Unmarshal(bodyBytes, &thread); err != nil {
+		logrus.Error("failed to unmarshal JSON response from get thread_contents request")
+		return nil, err
+	}
+
+	return thread.Data, nil
+}
+
+// ReplyToNote adds a Reply to a note. Attachments are uploaded to the note, which is where
+// Shotgun shows the files of a thread. When an attachment fails to upload, the created reply
+// is returned together with the error.
+func ReplyToNote(noteID int64, body string, attachments []string) (*ReplyData, error) {
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"entity":  LinkField{ID: noteID, Type: "Note"},
+		"content": body,
+	})
+	if err != nil {
+		logrus.Error("failed to marshal Reply to JSON")
+		return nil, err
+	}
+
+	req, err := NewCreateRequest("Reply", reqBody)
+	if err != nil {
+		logrus.Error("failed to create new Reply request")
+		return nil, err
+	}
+
+	var resp ReplyRecordResponse
+	if err = DoCreateRequest(req, &resp); err != nil {
+		logrus.Error("failed to make new Reply request")
+		return nil, err
+	}
+
+	reply := &ReplyData{
+		ID:        resp.Data.ID,
+		Note:      LinkField{ID: noteID, Type: "Note"},
+		Body:      resp.Data.Attributes.Body,
+		Author:    resp.Data.Relationships.Author.Data,
+		CreatedAt: resp.Data.Attributes.CreatedAt,
+	}
+
+	for _, path := range attachments {
+		if err = UploadFile("Note", noteID, "", path, UploadOptions{}); err != nil {
+			logrus.WithField("path", path).WithField("note_id", noteID).Error("failed to upload Reply attachment")
+			return reply, fmt.Errorf("Reply %v was created but uploading %v failed: %w", reply.ID, path, err)
+		}
+	}
+
+	return reply, nil
+}
@@ -2,15 +2,30 @@ package shotgun_api
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/sirupsen/logrus"
+	"time"
 )
 
 type NoteData struct {
-	ID        int64  `json:"id"`
-	Author    string `json:"author"`
-	Subject   string `json:"subject"`
-	Body      string `json:"body"`
-	CreatedAt string `json:"created_at"`
+	ID            int64       `json:"id"`
+	Author        string      `json:"author"`
+	User          LinkField   `json:"user"` // The author of the note.
+	Subject       string      `json:"subject"`
+	Body          string      `json:"body"`
+	CreatedAt     string      `json:"created_at"`
+	Status        string      `json:"status"`
+	Project       LinkField   `json:"project"`
+	Links         []LinkField `json:"note_links"`
+	Tasks         []LinkField `json:"tasks"`
+	AddressingsTo []LinkField `json:"addressings_to"`
+	AddressingsCc []LinkField `json:"addressings_cc"`
+	Attachments   []LinkField `json:"attachments"`
+}
+
+var noteFields = []string{
+	"id", "user", "subject", "content", "created_at", "sg_status_list", "project", "note_links", "tasks",
+	"addressings_to", "addressings_cc", "attachments",
 }
 
 type NoteRecord struct {
@@ -19,14 +34,51 @@ type NoteRecord struct {
 		Subject   string `json:"subject"`
 		Body      string `json:"content"`
 		CreatedAt string `json:"created_at"`
+		Status    string `json:"sg_status_list"`
 	} `json:"attributes"`
 	Relationships struct {
 		Author struct {
 			Data LinkField `json:"data"`
 		} `json:"user"`
+		Project struct {
+			Data LinkField `json:"data"`
+		} `json:"project"`
+		Links struct {
+			Data []LinkField `json:"data"`
+		} `json:"note_links"`
+		Tasks struct {
+			Data []LinkField `json:"data"`
+		} `json:"tasks"`
+		AddressingsTo struct {
+			Data []LinkField `json:"data"`
+		} `json:"addressings_to"`
+		AddressingsCc struct {
+			Data []LinkField `json:"data"`
+		} `json:"addressings_cc"`
+		Attachments struct {
+			Data []LinkField `json:"data"`
+		} `json:"attachments"`
 	} `json:"relationships"`
 }
 
+func newNoteData(record NoteRecord) *NoteData {
+	return &NoteData{
+		ID:            record.ID,
+		Subject:       record.Attributes.Subject,
+		Body:          record.Attributes.Body,
+		CreatedAt:     record.Attributes.CreatedAt,
+		Status:        record.Attributes.Status,
+		Author:        record.Relationships.Author.Data.Name,
+		User:          record.Relationships.Author.Data,
+		Project:       record.Relationships.Project.Data,
+		Links:         record.Relationships.Links.Data,
+		Tasks:         record.Relationships.Tasks.Data,
+		AddressingsTo: record.Relationships.AddressingsTo.Data,
+		AddressingsCc: record.Relationships.AddressingsCc.Data,
+		Attachments:   record.Relationships.Attachments.Data,
+	}
+}
+
 type NoteMultiRecordResponse struct {
 	Data []NoteRecord `json:"data"`
 }
@@ -53,44 +105,243 @@ func (t *NoteMultiRecordResponse) ReadRecord(data []byte) error {
 }
 
 func GetAllNotesForTask(taskID int64) ([]NoteData, error) {
-	filters := ShotgunFilters{
-		Expressions: []ShotgunFilterExpression{
-			{"tasks.Task.id", "is", taskID},
-		},
+	return GetNotesForEntity(LinkField{ID: taskID, Type: "Task"}, NoteFilter{})
+}
+
+const (
+	NoteStatusOpen   = "opn"
+	NoteStatusClosed = "clsd"
+)
+
+type NoteFilter struct {
+	Author        *LinkField // Only notes written by this HumanUser.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Status        string // NoteStatusOpen or NoteStatusClosed.
+}
+
+func (f NoteFilter) expressions() []ShotgunFilterExpression {
+	var result []ShotgunFilterExpression
+	if f.Author != nil {
+		result = append(result, ShotgunFilterExpression{"user", "is", f.Author.Ref()})
+	}
+	if !f.CreatedAfter.IsZero() {
+		result = append(result, ShotgunFilterExpression{"created_at", "greater_than", f.CreatedAfter.UTC().Format(time.RFC3339)})
+	}
+	if !f.CreatedBefore.IsZero() {
+		result = append(result, ShotgunFilterExpression{"created_at", "less_than", f.CreatedBefore.UTC().Format(time.RFC3339)})
+	}
+	if f.Status != "" {
+		result = append(result, ShotgunFilterExpression{"sg_status_list", "is", f.Status})
+	}
+	return result
+}
+
+// GetNotesForEntity returns the notes linked to an entity, e.g. a Version, Shot, Asset,
+// Playlist or Task, oldest first.
+func GetNotesForEntity(entity LinkField, filter NoteFilter) ([]NoteData, error) {
+	linkField := "note_links"
+	if entity.Type == "Task" {
+		linkField = "tasks"
 	}
-	fields := []string{
-		"id", "user", "subject", "content", "created_at",
+	filters := ShotgunFilters{
+		Expressions: append([]ShotgunFilterExpression{
+			{linkField, "in", []LinkField{entity.Ref()}},
+		}, filter.expressions()...),
 	}
 	sort := []SortParam{
 		{
 			FieldName: "created_at",
 			Direction: Ascending,
 		},
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
 	}
-	req, err := NewSearchRequest("Note", filters, fields, nil, sort)
+
+	var result []NoteData
+	for page := 1; ; page++ {
+		pageParam := PageParam{
+			Size:   maxSearchPageSize,
+			Number: page,
+		}
+		req, err := NewSearchRequest("Note", filters, noteFields, &pageParam, sort)
+		if err != nil {
+			logrus.Error("failed to create Note search request")
+			return nil, err
+		}
+
+		var resp NoteMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make Note search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, *newNoteData(record))
+		}
+		if len(resp.Data) < maxSearchPageSize {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func GetNoteForID(noteID int64) (*NoteData, error) {
+	req, err := NewFindRequest("Note", noteID, noteFields)
 	if err != nil {
-		logrus.Error("failed to create Note search request")
+		logrus.Error("failed to create Note find request")
 		return nil, err
 	}
 
-	var resp NoteMultiRecordResponse
-	if err = DoSearchRequest(req, &resp); err != nil {
-		logrus.Error("failed to make Note search request")
+	var resp NoteRecordResponse
+	if err = DoFindRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Note find request")
 		return nil, err
 	}
 
-	var result []NoteData
-	for _, record := range resp.Data {
-		task := NoteData{
-			ID:        record.ID,
-			Subject:   record.Attributes.Subject,
-			Body:      record.Attributes.Body,
-			CreatedAt: record.Attributes.CreatedAt,
-			Author:    record.Relationships.Author.Data.Name,
+	return newNoteData(resp.Data), nil
+}
+
+type NoteOptions struct {
+	Subject     string
+	Content     string
+	Project     LinkField   // Required.
+	Links       []LinkField // Entities the note is about. Tasks are set on the tasks field instead of note_links.
+	To          []LinkField // HumanUsers and Groups the note is addressed to.
+	Cc          []LinkField // HumanUsers and Groups copied on the note.
+	Author      *LinkField  // Defaults to the script user.
+	Attachments []string    // Paths of files uploaded to the note.
+
+	IgnoreMentions bool // Do not address the users and groups @mentioned in Content.
+}
+
+// CreateNote creates a Note and uploads its attachments. Users and groups @mentioned in the
+// content are added to the addressings_to. When an attachment fails to upload, the created
+// note is returned together with the error.
+func CreateNote(opts NoteOptions) (*NoteData, error) {
+	if opts.Project.ID == 0 {
+		return nil, fmt.Errorf("a Project is required to create a Note")
+	}
+
+	to := opts.To
+	if !opts.IgnoreMentions {
+		mentions, err := ResolveMentions(ParseMentions(opts.Content))
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range MentionedEntities(mentions) {
+			if !containsLink(to, entity) && !containsLink(opts.Cc, entity) {
+				to = append(to, entity)
+			}
 		}
+	}
 
-		result = append(result, task)
+	links := []LinkField{}
+	tasks := []LinkField{}
+	for _, link := range opts.Links {
+		if link.Type == "Task" {
+			tasks = append(tasks, link.Ref())
+		} else {
+			links = append(links, link.Ref())
+		}
 	}
 
-	return result, nil
+	body := map[string]interface{}{
+		"subject":        opts.Subject,
+		"content":        opts.Content,
+		"project":        opts.Project.Ref(),
+		"note_links":     links,
+		"tasks":          tasks,
+		"addressings_to": linkRefs(to),
+		"addressings_cc": linkRefs(opts.Cc),
+	}
+	if opts.Author != nil {
+		body["user"] = opts.Author.Ref()
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		logrus.Error("failed to marshal Note to JSON")
+		return nil, err
+	}
+
+	req, err := NewCreateRequest("Note", reqBody)
+	if err != nil {
+		logrus.Error("failed to create new Note request")
+		return nil, err
+	}
+
+	var resp NoteRecordResponse
+	if err = DoCreateRequest(req, &resp); err != nil {
+		logrus.Error("failed to make new Note request")
+		return nil, err
+	}
+
+	var uploadErr error
+	for _, path := range opts.Attachments {
+		if err = UploadFile("Note", resp.Data.ID, "", path, UploadOptions{}); err != nil {
+			logrus.WithField("path", path).WithField("note_id", resp.Data.ID).Error("failed to upload Note attachment")
+			uploadErr = fmt.Errorf("Note %v was created but uploading %v failed: %w", resp.Data.ID, path, err)
+			break
+		}
+	}
+
+	note, err := GetNoteForID(resp.Data.ID)
+	if err != nil {
+		return nil, err
+	}
+	return note, uploadErr
+}
+
+func linkRefs(links []LinkField) []LinkField {
+	result := make([]LinkField, 0, len(links))
+	for _, link := range links {
+		result = append(result, link.Ref())
+	}
+	return result
+}
+
+// MarkNoteRead marks a note as read for the HumanUser with the given login.
+func MarkNoteRead(noteID int64, login string) error {
+	return setNoteReadState(noteID, login, "read")
+}
+
+// MarkNoteUnread marks a note as unread for the HumanUser with the given login.
+func MarkNoteUnread(noteID int64, login string) error {
+	return setNoteReadState(noteID, login, "unread")
+}
+
+// setNoteReadState updates read_by_current_user, which Shotgun keeps per user, so the update
+// is made as that user.
+func setNoteReadState(noteID int64, login, state string) error {
+	auth, err := AuthenticateShotgunScriptAsUser(login)
+	if err != nil {
+		logrus.WithField("login", login).Error("failed to authenticate as user")
+		return err
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"read_by_current_user": state,
+	})
+	if err != nil {
+		logrus.WithError(err).Error("failed to create request body")
+		return err
+	}
+
+	req, err := NewUpdateRequest("Note", noteID, []string{"id", "read_by_current_user"}, data)
+	if err != nil {
+		logrus.Error("failed to create update Note request")
+		return err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken))
+
+	var resp NoteRecordResponse
+	if err = DoUpdateRequest(req, &resp); err != nil {
+		logrus.WithField("note_id", noteID).Error("failed to make update Note request")
+		return err
+	}
+	return nil
 }
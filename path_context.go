@@ -0,0 +1,199 @@
+package shotgun_api
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+)
+
+// PathContext is the Shotgun context a filesystem path belongs to.
+type PathContext struct {
+	Path     string                 `json:"path"`
+	Template string                 `json:"template"`
+	Fields   map[string]interface{} `json:"fields"`
+	Project  *ProjectData           `json:"project,omitempty"`
+	Sequence *SequenceData          `json:"sequence,omitempty"`
+	Shot     *ShotData              `json:"shot,omitempty"`
+	Asset    *AssetData             `json:"asset,omitempty"`
+	Step     *StepData              `json:"step,omitempty"`
+	Version  *VersionData           `json:"version,omitempty"`
+}
+
+// ParsePath matches a path, or the nearest of its parent folders, against the configured
+// path templates and resolves the extracted fields to Shotgun entities.
+func ParsePath(path string) (*PathContext, error) {
+	template, fields, err := MatchPathTemplate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PathContext{
+		Path:     path,
+		Template: template.Name,
+		Fields:   fields,
+	}
+
+	projectName, _ := fields["Project"].(string)
+	if projectName == "" {
+		return result, nil
+	}
+	result.Project, err = GetProjectByName(projectName)
+	if err != nil {
+		logrus.WithField("project", projectName).Error("failed to resolve Project from path")
+		return nil, err
+	}
+
+	if sequenceName, ok := fields["Sequence"].(string); ok {
+		result.Sequence, err = GetSequenceByCode(result.Project.ID, sequenceName)
+		if err != nil {
+			logrus.WithField("sequence", sequenceName).Error("failed to resolve Sequence from path")
+			return nil, err
+		}
+	}
+
+	var entity LinkField
+	if shotName, ok := fields["Shot"].(string); ok {
+		result.Shot, err = GetShotByCode(result.Project.ID, shotName)
+		if err != nil {
+			logrus.WithField("shot", shotName).Error("failed to resolve Shot from path")
+			return nil, err
+		}
+		entity = LinkField{ID: result.Shot.ID, Type: "Shot", Name: result.Shot.Name}
+	} else if assetName, ok := fields["Asset"].(string); ok {
+		result.Asset, err = GetAssetByCode(result.Project.ID, assetName)
+		if err != nil {
+			logrus.WithField("asset", assetName).Error("failed to resolve Asset from path")
+			return nil, err
+		}
+		entity = LinkField{ID: result.Asset.ID, Type: "Asset", Name: result.Asset.Name}
+	}
+
+	if stepName, ok := fields["Step"].(string); ok && entity.Type != "" {
+		result.Step, err = GetStepByShortName(entity.Type, stepName)
+		if err != nil {
+			logrus.WithField("step", stepName).Error("failed to resolve Step from path")
+			return nil, err
+		}
+	}
+
+	if versionNumber, ok := fields["version"].(int64); ok && entity.Type != "" {
+		filters := ShotgunFilters{
+			Expressions: []ShotgunFilterExpression{
+				{"entity", "is", LinkField{ID: entity.ID, Type: entity.Type}},
+				{"sg_version_number", "is", versionNumber},
+			},
+		}
+		if result.Step != nil {
+			filters.Expressions = append(filters.Expressions,
+				ShotgunFilterExpression{"sg_task.Task.step.Step.id", "is", result.Step.ID},
+			)
+		}
+		sort := []SortParam{
+			{
+				FieldName: "created_at",
+				Direction: Descending,
+			},
+		}
+		result.Version, err = FindOneVersion(filters, sort)
+		if err != nil {
+			logrus.WithField("version", versionNumber).Error("failed to resolve Version from path")
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Context converts the resolved entities to a Context.
+func (p *PathContext) Context() *Context {
+	ctx := &Context{}
+	if p.Project != nil {
+		ctx.Project = LinkField{ID: p.Project.ID, Type: "Project", Name: p.Project.Name}
+	}
+	if p.Shot != nil {
+		ctx.Entity = &LinkField{ID: p.Shot.ID, Type: "Shot", Name: p.Shot.Name}
+		if p.Sequence != nil {
+			ctx.Sequence = &LinkField{ID: p.Sequence.ID, Type: "Sequence", Name: p.Sequence.Name}
+		}
+	}
+	if p.Asset != nil {
+		ctx.Entity = &LinkField{ID: p.Asset.ID, Type: "Asset", Name: p.Asset.Name}
+		ctx.AssetType = p.Asset.Group
+	}
+	if p.Step != nil {
+		ctx.Step = &LinkField{ID: p.Step.ID, Type: "Step", Name: p.Step.LongName}
+		ctx.StepShortName = p.Step.ShortName
+	}
+	if p.Version != nil {
+		ctx.Source = &LinkField{ID: p.Version.ID, Type: "Version", Name: p.Version.Name}
+		if p.Version.Task.ID > 0 {
+			task := p.Version.Task
+			ctx.Task = &task
+		}
+	}
+	return ctx
+}
+
+// MatchPathTemplate returns the template matching the path, or the nearest of its parent
+// folders, along with the extracted fields. Project templates are tried before the global
+// ones, and a path matching the templates of several projects is reported as ambiguous.
+func MatchPathTemplate(path string) (*PathTemplate, map[string]interface{}, error) {
+	var projectNames []string
+	for projectName := range PathTemplates.Projects {
+		projectNames = append(projectNames, projectName)
+	}
+	sort.Strings(projectNames)
+
+	for current := filepath.Clean(path); ; current = filepath.Dir(current) {
+		var matched []string
+		var template *PathTemplate
+		var fields map[string]interface{}
+		for _, projectName := range projectNames {
+			if t, f, ok := matchProjectTemplates(current, projectName); ok {
+				matched = append(matched, projectName)
+				template, fields = t, f
+			}
+		}
+		if len(matched) > 1 {
+			return nil, nil, fmt.Errorf("path %v matches the path templates of several projects: %v", path, matched)
+		}
+		if len(matched) == 1 {
+			return template, fields, nil
+		}
+		if t, f, ok := matchProjectTemplates(current, ""); ok {
+			return t, f, nil
+		}
+
+		if parent := filepath.Dir(current); parent == current {
+			break
+		}
+	}
+
+	return nil, nil, fmt.Errorf("path %v does not match any path template", path)
+}
+
+// matchProjectTemplates returns the first template of a project matching the path. An empty
+// project name matches with the global templates only. A project template that resolves the
+// same as the global one only matches when the path names the project.
+func matchProjectTemplates(path, projectName string) (*PathTemplate, map[string]interface{}, bool) {
+	for _, template := range PathTemplates.ProjectTemplates(projectName) {
+		fields, err := template.Parse(path)
+		if err != nil {
+			continue
+		}
+		if projectName != "" {
+			name, ok := fields["Project"]
+			if ok && name != projectName {
+				continue
+			}
+			if global, err := PathTemplates.GetTemplate("", template.Name); !ok && err == nil &&
+				global.Root == template.Root && global.Definition == template.Definition {
+				continue
+			}
+			fields["Project"] = projectName
+		}
+		return template, fields, true
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,424 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+type PlaylistData struct {
+	ID          int64         `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Date        string        `json:"date"`
+	Project     LinkField     `json:"project"`
+	Versions    []VersionData `json:"versions"` // In cut order, only filled in by GetPlaylistForID.
+}
+
+var playlistFields = []string{
+	"id", "code", "description", "sg_date_and_time", "project",
+}
+
+type PlaylistRecord struct {
+	ID         int64 `json:"id"`
+	Attributes struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+		Date        string `json:"sg_date_and_time"`
+	} `json:"attributes"`
+	Relationships struct {
+		Project struct {
+			Data LinkField `json:"data"`
+		} `json:"project"`
+	} `json:"relationships"`
+}
+
+type PlaylistMultiRecordResponse struct {
+	Data []PlaylistRecord `json:"data"`
+}
+
+type PlaylistRecordResponse struct {
+	Data PlaylistRecord `json:"data"`
+}
+
+func (e *PlaylistRecordResponse) ReadRecord(data []byte) error {
+	if err := json.Unmarshal(data, &e); err != nil {
+		logrus.Error("failed to unmarshal Playlist response")
+		return err
+	}
+	return nil
+}
+
+func (t *PlaylistMultiRecordResponse) ReadRecord(data []byte) error {
+	err := json.Unmarshal(data, &t)
+	if err != nil {
+		logrus.Error("failed to unmarshal data to PlaylistMultiRecord")
+		return err
+	}
+	return nil
+}
+
+func newPlaylistData(record PlaylistRecord) *PlaylistData {
+	return &PlaylistData{
+		ID:          record.ID,
+		Name:        record.Attributes.Code,
+		Description: record.Attributes.Description,
+		Date:        record.Attributes.Date,
+		Project:     record.Relationships.Project.Data,
+	}
+}
+
+// playlistConnection links a Version to a Playlist; sg_sort_order is its position in the cut.
+type playlistConnection struct {
+	ID        int64
+	Version   LinkField
+	SortOrder int64
+}
+
+type PlaylistVersionConnectionRecord struct {
+	ID         int64 `json:"id"`
+	Attributes struct {
+		SortOrder int64 `json:"sg_sort_order"`
+	} `json:"attributes"`
+	Relationships struct {
+		Version struct {
+			Data LinkField `json:"data"`
+		} `json:"version"`
+	} `json:"relationships"`
+}
+
+type PlaylistVersionConnectionMultiRecordResponse struct {
+	Data []PlaylistVersionConnectionRecord `json:"data"`
+}
+
+func (t *PlaylistVersionConnectionMultiRecordResponse) ReadRecord(data []byte) error {
+	err := json.Unmarshal(data, &t)
+	if err != nil {
+		logrus.Error("failed to unmarshal data to PlaylistVersionConnectionMultiRecord")
+		return err
+	}
+	return nil
+}
+
+type PlaylistVersionConnectionRecordResponse struct {
+	Data PlaylistVersionConnectionRecord `json:"data"`
+}
+
+func (e *PlaylistVersionConnectionRecordResponse) ReadRecord(data []byte) error {
+	if err := json.Unmarshal(data, &e); err != nil {
+		logrus.Error("failed to unmarshal PlaylistVersionConnection response")
+		return err
+	}
+	return nil
+}
+
+func CreatePlaylist(project LinkField, name string, date time.Time, description string) (*PlaylistData, error) {
+	if project.ID == 0 {
+		return nil, fmt.Errorf("a Project is required to create a Playlist")
+	}
+
+	body := map[string]interface{}{
+		"code":        name,
+		"project":     project.Ref(),
+		"description": description,
+	}
+	if !date.IsZero() {
+		body["sg_date_and_time"] = date.UTC().Format(time.RFC3339)
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		logrus.Error("failed to marshal Playlist to JSON")
+		return nil, err
+	}
+
+	req, err := NewCreateRequest("Playlist", reqBody)
+	if err != nil {
+		logrus.Error("failed to create new Playlist request")
+		return nil, err
+	}
+
+	var resp PlaylistRecordResponse
+	if err = DoCreateRequest(req, &resp); err != nil {
+		logrus.Error("failed to make new Playlist request")
+		return nil, err
+	}
+
+	return newPlaylistData(resp.Data), nil
+}
+
+// GetPlaylistForID returns a Playlist with its Versions in cut order.
+func GetPlaylistForID(playlistID int64) (*PlaylistData, error) {
+	req, err := NewFindRequest("Playlist", playlistID, playlistFields)
+	if err != nil {
+		logrus.Error("failed to create Playlist find request")
+		return nil, err
+	}
+
+	var resp PlaylistRecordResponse
+	if err = DoFindRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Playlist find request")
+		return nil, err
+	}
+	playlist := newPlaylistData(resp.Data)
+
+	connections, err := getPlaylistConnections(playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	versionIDs := make([]int64, 0, len(connections))
+	for _, connection := range connections {
+		versionIDs = append(versionIDs, connection.Version.ID)
+	}
+	versions, err := GetVersionsForIDs(versionIDs)
+	if err != nil {
+		logrus.WithField("playlist_id", playlistID).Error("failed to retrieve Playlist Versions")
+		return nil, err
+	}
+
+	byID := map[int64]VersionData{}
+	for _, version := range versions {
+		byID[version.ID] = version
+	}
+	for _, connection := range connections {
+		if version, ok := byID[connection.Version.ID]; ok {
+			playlist.Versions = append(playlist.Versions, version)
+		}
+	}
+
+	return playlist, nil
+}
+
+// GetPlaylistsForProject returns the Playlists of a project, newest first. Zero times leave
+// that end of the date range open.
+func GetPlaylistsForProject(projectID int64, from, to time.Time) ([]PlaylistData, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"project.Project.id", "is", projectID},
+		},
+	}
+	if !from.IsZero() {
+		filters.Expressions = append(filters.Expressions, ShotgunFilterExpression{"sg_date_and_time", "greater_than", from.UTC().Format(time.RFC3339)})
+	}
+	if !to.IsZero() {
+		filters.Expressions = append(filters.Expressions, ShotgunFilterExpression{"sg_date_and_time", "less_than", to.UTC().Format(time.RFC3339)})
+	}
+	sort := []SortParam{
+		{
+			FieldName: "sg_date_and_time",
+			Direction: Descending,
+		},
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+
+	var result []PlaylistData
+	for page := 1; ; page++ {
+		pageParam := PageParam{
+			Size:   maxSearchPageSize,
+			Number: page,
+		}
+		req, err := NewSearchRequest("Playlist", filters, playlistFields, &pageParam, sort)
+		if err != nil {
+			logrus.Error("failed to create Playlist search request")
+			return nil, err
+		}
+
+		var resp PlaylistMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make Playlist search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, *newPlaylistData(record))
+		}
+		if len(resp.Data) < maxSearchPageSize {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// AddVersionsToPlaylist appends Versions to the end of the cut. Versions already in the
+// Playlist are skipped.
+func AddVersionsToPlaylist(playlistID int64, versionIDs []int64) error {
+	connections, err := getPlaylistConnections(playlistID)
+	if err != nil {
+		return err
+	}
+
+	var sortOrder int64
+	existing := map[int64]bool{}
+	for _, connection := range connections {
+		existing[connection.Version.ID] = true
+		if connection.SortOrder > sortOrder {
+			sortOrder = connection.SortOrder
+		}
+	}
+
+	for _, versionID := range versionIDs {
+		if existing[versionID] {
+			continue
+		}
+		existing[versionID] = true
+		sortOrder++
+
+		reqBody, err := json.Marshal(map[string]interface{}{
+			"playlist":      LinkField{ID: playlistID, Type: "Playlist"},
+			"version":       LinkField{ID: versionID, Type: "Version"},
+			"sg_sort_order": sortOrder,
+		})
+		if err != nil {
+			logrus.Error("failed to marshal PlaylistVersionConnection to JSON")
+			return err
+		}
+
+		req, err := NewCreateRequest("PlaylistVersionConnection", reqBody)
+		if err != nil {
+			logrus.Error("failed to create new PlaylistVersionConnection request")
+			return err
+		}
+
+		var resp PlaylistVersionConnectionRecordResponse
+		if err = DoCreateRequest(req, &resp); err != nil {
+			logrus.WithField("version_id", versionID).Error("failed to add Version to Playlist")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func RemoveVersionsFromPlaylist(playlistID int64, versionIDs []int64) error {
+	connections, err := getPlaylistConnections(playlistID)
+	if err != nil {
+		return err
+	}
+
+	for _, connection := range connections {
+		if !containsID(versionIDs, connection.Version.ID) {
+			continue
+		}
+
+		req, err := NewDeleteRequest("PlaylistVersionConnection", connection.ID)
+		if err != nil {
+			return err
+		}
+		if err = DoDeleteRequest(req); err != nil {
+			logrus.WithField("version_id", connection.Version.ID).Error("failed to remove Version from Playlist")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReorderPlaylist puts the given Versions first in the cut, in the given order. The other
+// Versions of the Playlist keep their relative order after them.
+func ReorderPlaylist(playlistID int64, versionIDs []int64) error {
+	connections, err := getPlaylistConnections(playlistID)
+	if err != nil {
+		return err
+	}
+
+	position := map[int64]int{}
+	for i, versionID := range versionIDs {
+		if _, ok := position[versionID]; !ok {
+			position[versionID] = i
+		}
+	}
+	sort.SliceStable(connections, func(i, j int) bool {
+		pi, iok := position[connections[i].Version.ID]
+		pj, jok := position[connections[j].Version.ID]
+		if iok && jok {
+			return pi < pj
+		}
+		return iok && !jok
+	})
+
+	for i, connection := range connections {
+		sortOrder := int64(i + 1)
+		if connection.SortOrder == sortOrder {
+			continue
+		}
+
+		data, err := json.Marshal(map[string]interface{}{
+			"sg_sort_order": sortOrder,
+		})
+		if err != nil {
+			logrus.WithError(err).Error("failed to create request body")
+			return err
+		}
+
+		req, err := NewUpdateRequest("PlaylistVersionConnection", connection.ID, []string{"id", "sg_sort_order"}, data)
+		if err != nil {
+			logrus.Error("failed to create update PlaylistVersionConnection request")
+			return err
+		}
+
+		var resp PlaylistVersionConnectionRecordResponse
+		if err = DoUpdateRequest(req, &resp); err != nil {
+			logrus.WithField("version_id", connection.Version.ID).Error("failed to reorder Playlist Version")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getPlaylistConnections returns the Version connections of a Playlist in cut order.
+func getPlaylistConnections(playlistID int64) ([]playlistConnection, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"playlist", "is", LinkField{ID: playlistID, Type: "Playlist"}},
+		},
+	}
+	sort := []SortParam{
+		{
+			FieldName: "sg_sort_order",
+			Direction: Ascending,
+		},
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+	var result []playlistConnection
+	for page := 1; ; page++ {
+		pageParam := PageParam{
+			Size:   maxSearchPageSize,
+			Number: page,
+		}
+		req, err := NewSearchRequest("PlaylistVersionConnection", filters, []string{"id", "version", "sg_sort_order"}, &pageParam, sort)
+		if err != nil {
+			logrus.Error("failed to create PlaylistVersionConnection search request")
+			return nil, err
+		}
+
+		var resp PlaylistVersionConnectionMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make PlaylistVersionConnection search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, playlistConnection{
+				ID:        record.ID,
+				Version:   record.Relationships.Version.Data,
+				SortOrder: record.Attributes.SortOrder,
+			})
+		}
+		if len(resp.Data) < maxSearchPageSize {
+			break
+		}
+	}
+
+	return result, nil
+}
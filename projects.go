@@ -2,6 +2,7 @@ package shotgun_api
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"path/filepath"
 )
@@ -88,7 +89,11 @@ func GetAllProjectsForUser(username string) ([]ProjectData, error) {
 }
 
 func GetProjectPath(projectName string) string {
-	return filepath.Join(GetPlatformProjectsPath(), projectName)
+	rootPath, err := PathTemplates.RootPath(projectName, PrimaryStorageRoot)
+	if err != nil {
+		rootPath = GetPlatformProjectsPath()
+	}
+	return filepath.Join(rootPath, projectName)
 }
 
 func GetProjectFromID(projectID int64) (*ProjectData, error) {
@@ -112,3 +117,35 @@ func GetProjectFromID(projectID int64) (*ProjectData, error) {
 
 	return result, nil
 }
+
+func GetProjectByName(projectName string) (*ProjectData, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"name", "is", projectName},
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+	req, err := NewSearchRequest("Project", filters, projectFields, &page, nil)
+	if err != nil {
+		logrus.Error("failed to create Project search request")
+		return nil, err
+	}
+
+	var resp ProjectMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Project search request")
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no Projects found with name: %v", projectName)
+	}
+
+	return &ProjectData{
+		ID:        resp.Data[0].ID,
+		Name:      resp.Data[0].Attributes.Name,
+		Thumbnail: resp.Data[0].Attributes.Image,
+	}, nil
+}
@@ -0,0 +1,285 @@
+package shotgun_api
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sort"
+)
+
+type DependencyDirection int
+
+const (
+	UpstreamDependencies DependencyDirection = iota
+	DownstreamDependencies
+)
+
+// SetPublishDependencies replaces the upstream PublishedFiles of a publish. Shotgun keeps the
+// downstream_published_files of the upstream publishes in sync.
+func SetPublishDependencies(publishID int64, upstreamIDs []int64) error {
+	upstream := make([]LinkField, 0, len(upstreamIDs))
+	for _, id := range upstreamIDs {
+		if id == publishID {
+			return fmt.Errorf("PublishedFile %v can not depend on itself", publishID)
+		}
+		upstream = append(upstream, LinkField{ID: id, Type: "PublishedFile"})
+	}
+
+	publish := PublishedFileData{ID: publishID}
+	return publish.SetField("upstream_published_files", upstream)
+}
+
+func GetPublishedFilesForIDs(publishIDs []int64) ([]PublishedFileData, error) {
+	var result []PublishedFileData
+	for start := 0; start < len(publishIDs); start += maxSearchPageSize {
+		end := start + maxSearchPageSize
+		if end > len(publishIDs) {
+			end = len(publishIDs)
+		}
+
+		filters := ShotgunFilters{
+			Expressions: []ShotgunFilterExpression{
+				{"id", "in", publishIDs[start:end]},
+			},
+		}
+		page := PageParam{
+			Size: maxSearchPageSize,
+		}
+		req, err := NewSearchRequest("PublishedFile", filters, publishedFileFields, &page, nil)
+		if err != nil {
+			logrus.Error("failed to create PublishedFile search request")
+			return nil, err
+		}
+
+		var resp PublishedFileMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make PublishedFile search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, *newPublishedFileData(record))
+		}
+	}
+
+	resolveLocalPaths(result)
+	return result, nil
+}
+
+type PublishGraphNode struct {
+	Publish PublishedFileData `json:"publish"`
+	Depth   int               `json:"depth"`
+}
+
+// PublishGraphEdge points from an upstream publish to the publish that depends on it.
+type PublishGraphEdge struct {
+	Upstream   int64 `json:"upstream"`
+	Downstream int64 `json:"downstream"`
+}
+
+type PublishGraph struct {
+	Root      int64                       `json:"root"`
+	Direction DependencyDirection         `json:"direction"`
+	Nodes     map[int64]*PublishGraphNode `json:"nodes"`
+	Edges     []PublishGraphEdge          `json:"edges"`
+	Cycles    []PublishGraphEdge          `json:"cycles"` // Edges left out of Edges because they close a cycle.
+	Truncated bool                        `json:"truncated"`
+}
+
+// GetPublishDependencyGraph walks the dependencies of a publish breadth-first, fetching each
+// level with a single search. A maxDepth of zero or less walks the whole graph.
+func GetPublishDependencyGraph(publishID int64, direction DependencyDirection, maxDepth int) (*PublishGraph, error) {
+	graph := &PublishGraph{
+		Root:      publishID,
+		Direction: direction,
+		Nodes:     map[int64]*PublishGraphNode{},
+	}
+
+	var candidateEdges []PublishGraphEdge
+	seenEdges := map[PublishGraphEdge]bool{}
+	level := []int64{publishID}
+	for depth := 0; len(level) > 0; depth++ {
+		publishes, err := GetPublishedFilesForIDs(level)
+		if err != nil {
+			return nil, err
+		}
+
+		var next []int64
+		for _, publish := range publishes {
+			graph.Nodes[publish.ID] = &PublishGraphNode{Publish: publish, Depth: depth}
+		}
+		for _, publish := range publishes {
+			links := publish.Upstream
+			if direction == DownstreamDependencies {
+				links = publish.Downstream
+			}
+			if len(links) > 0 && maxDepth > 0 && depth >= maxDepth {
+				graph.Truncated = true
+				continue
+			}
+
+			for _, link := range links {
+				edge := PublishGraphEdge{Upstream: link.ID, Downstream: publish.ID}
+				if direction == DownstreamDependencies {
+					edge = PublishGraphEdge{Upstream: publish.ID, Downstream: link.ID}
+				}
+				if !seenEdges[edge] {
+					seenEdges[edge] = true
+					candidateEdges = append(candidateEdges, edge)
+				}
+
+				if _, ok := graph.Nodes[link.ID]; !ok && !containsID(next, link.ID) {
+					next = append(next, link.ID)
+				}
+			}
+		}
+		level = next
+	}
+
+	graph.Edges, graph.Cycles = splitCycleEdges(graph.Root, direction, candidateEdges)
+	if len(graph.Cycles) > 0 {
+		logrus.WithField("published_file_id", publishID).Warnf("dependency graph contains %v cyclic edges", len(graph.Cycles))
+	}
+
+	return graph, nil
+}
+
+// splitCycleEdges removes the back edges found by a depth-first walk from the root, which
+// leaves the remaining edges acyclic.
+func splitCycleEdges(root int64, direction DependencyDirection, edges []PublishGraphEdge) ([]PublishGraphEdge, []PublishGraphEdge) {
+	children := map[int64][]PublishGraphEdge{}
+	for _, edge := range edges {
+		from := edge.Downstream
+		if direction == DownstreamDependencies {
+			from = edge.Upstream
+		}
+		children[from] = append(children[from], edge)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[int64]int{}
+	var acyclic, cycles []PublishGraphEdge
+
+	var walk func(id int64)
+	walk = func(id int64) {
+		state[id] = visiting
+		for _, edge := range children[id] {
+			to := edge.Upstream
+			if direction == DownstreamDependencies {
+				to = edge.Downstream
+			}
+
+			switch state[to] {
+			case visiting:
+				cycles = append(cycles, edge)
+			case unvisited:
+				acyclic = append(acyclic, edge)
+				walk(to)
+			default:
+				acyclic = append(acyclic, edge)
+			}
+		}
+		state[id] = visited
+	}
+	walk(root)
+
+	return acyclic, cycles
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, item := range ids {
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TopologicalOrder returns the node IDs with every upstream publish before its dependents.
+func (g *PublishGraph) TopologicalOrder() []int64 {
+	inDegree := map[int64]int{}
+	dependents := map[int64][]int64{}
+	for id := range g.Nodes {
+		inDegree[id] = 0
+	}
+	for _, edge := range g.Edges {
+		inDegree[edge.Downstream]++
+		dependents[edge.Upstream] = append(dependents[edge.Upstream], edge.Downstream)
+	}
+
+	var ready []int64
+	for id, degree := range inDegree {
+		if degree == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	var result []int64
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return ready[i] < ready[j] })
+		id := ready[0]
+		ready = ready[1:]
+		result = append(result, id)
+
+		for _, dependent := range dependents[id] {
+			inDegree[dependent]--
+			if inDegree[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	return result
+}
+
+type StalePublish struct {
+	Publish  PublishedFileData `json:"publish"`  // The downstream publish built from an old version.
+	Upstream PublishedFileData `json:"upstream"` // The version it was built from.
+	Latest   PublishedFileData `json:"latest"`   // The newest version of the upstream stream.
+}
+
+// FindStaleDownstreamPublishes walks the publishes downstream of publishID and returns those
+// that depend on a publish which is no longer the latest version of its stream.
+func FindStaleDownstreamPublishes(publishID int64, maxDepth int) ([]StalePublish, error) {
+	graph, err := GetPublishDependencyGraph(publishID, DownstreamDependencies, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	latestByStream := map[string]*PublishedFileData{}
+	var result []StalePublish
+	for _, edge := range graph.Edges {
+		upstream, ok := graph.Nodes[edge.Upstream]
+		if !ok {
+			continue
+		}
+		downstream, ok := graph.Nodes[edge.Downstream]
+		if !ok {
+			continue
+		}
+
+		publish := upstream.Publish
+		key := publishStreamKey(publish)
+		latest, ok := latestByStream[key]
+		if !ok {
+			latest, err = GetLatestPublish(publish.Entity, publish.Name, publish.PublishedFileType.Name)
+			if err != nil {
+				return nil, err
+			}
+			latestByStream[key] = latest
+		}
+
+		if latest != nil && latest.VersionNumber > publish.VersionNumber {
+			result = append(result, StalePublish{
+				Publish:  downstream.Publish,
+				Upstream: publish,
+				Latest:   *latest,
+			})
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,435 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type PublishOptions struct {
+	Name              string  // Name of the publish stream, defaults to the file name without its extension.
+	PublishedFileType string  // Code of the PublishedFileType, created when it does not exist yet.
+	Description       string  // Description set on the PublishedFile and the Version.
+	VersionNumber     int64   // Forces the version number instead of allocating the next one in the stream.
+	Dependencies      []int64 // IDs of the upstream PublishedFiles.
+	CreateVersion     bool    // Also create a Version linked to the PublishedFile.
+}
+
+// RegisterPublish creates a PublishedFile for a file on disk in the given context, and records
+// the publish in the EventLogEntry stream. The next version number of the stream is allocated
+// by creating the PublishedFile and checking that no concurrent publish took the same number.
+// The Version of CreateVersion is created once the number is allocated; when it fails, the
+// PublishedFile is deleted again.
+func RegisterPublish(ctx Context, path string, opts PublishOptions) (*PublishedFileData, error) {
+	if ctx.Project.ID == 0 {
+		return nil, fmt.Errorf("cannot register publish without a Project in the Context")
+	}
+
+	fileName := filepath.Base(path)
+	name := opts.Name
+	if name == "" {
+		name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+
+	var fileType *LinkField
+	if opts.PublishedFileType != "" {
+		publishedFileType, err := GetOrCreatePublishedFileType(opts.PublishedFileType)
+		if err != nil {
+			logrus.WithField("published_file_type", opts.PublishedFileType).Error("failed to retrieve PublishedFileType")
+			return nil, err
+		}
+		fileType = publishedFileType
+	}
+
+	body := map[string]interface{}{
+		"code":    fileName,
+		"name":    name,
+		"project": ctx.Project.Ref(),
+		"path": map[string]interface{}{
+			"local_path": path,
+		},
+	}
+	if opts.Description != "" {
+		body["description"] = opts.Description
+	}
+	if ctx.Entity != nil {
+		body["entity"] = ctx.Entity.Ref()
+	}
+	if ctx.Task != nil {
+		body["task"] = ctx.Task.Ref()
+	}
+	if fileType != nil {
+		body["published_file_type"] = fileType.Ref()
+	}
+	if len(opts.Dependencies) > 0 {
+		var upstream []LinkField
+		for _, id := range opts.Dependencies {
+			upstream = append(upstream, LinkField{ID: id, Type: "PublishedFile"})
+		}
+		body["upstream_published_files"] = upstream
+	}
+
+	publishID, versionNumber, err := allocatePublishedFile(ctx, name, fileType, opts.VersionNumber, body)
+	if err != nil {
+		logrus.WithField("name", name).Error("failed to create PublishedFile")
+		return nil, err
+	}
+
+	if opts.CreateVersion {
+		if err = linkPublishVersion(ctx, publishID, name, versionNumber, opts.Description); err != nil {
+			if deleteErr := deletePublishedFile(publishID); deleteErr != nil {
+				logrus.WithField("published_file_id", publishID).Error("failed to delete PublishedFile of failed publish")
+			}
+			return nil, err
+		}
+	}
+
+	publishedFile := LinkField{ID: publishID, Type: "PublishedFile", Name: fileName}
+	event := EventData{
+		EventType:   "API_PublishedFile_Registered",
+		Description: fmt.Sprintf("Registered publish %v v%03d", name, versionNumber),
+		Entity:      publishedFile.Ref(),
+		Project:     ctx.Project.Ref(),
+		Metadata: map[string]interface{}{
+			"path":           path,
+			"name":           name,
+			"version_number": versionNumber,
+		},
+	}
+	if err = NewEvent(&event); err != nil {
+		logrus.WithError(err).WithField("published_file_id", publishID).Error("failed to record publish event")
+	}
+
+	return GetPublishedFileForID(publishID)
+}
+
+// allocatePublishedFile creates the PublishedFile with the forced version number, or with the
+// next number of its stream. After creating it, any other publish of the stream holding the
+// same number is looked up and the oldest one wins; the loser is deleted and retries with the
+// following number.
+func allocatePublishedFile(ctx Context, name string, fileType *LinkField, forced int64, body map[string]interface{}) (int64, int64, error) {
+	if forced > 0 {
+		body["version_number"] = forced
+		id, err := createPublishedFileRecord(body)
+		return id, forced, err
+	}
+
+	latest, err := findLatestPublishVersionNumber(ctx, name, fileType)
+	if err != nil {
+		logrus.WithField("name", name).Error("failed to compute next publish version number")
+		return 0, 0, err
+	}
+
+	candidate := latest + 1
+	for attempt := 0; attempt < maxVersionAllocationAttempts; attempt++ {
+		body["version_number"] = candidate
+		id, err := createPublishedFileRecord(body)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		winner, err := findFirstPublishWithVersionNumber(ctx, name, fileType, candidate)
+		if err != nil {
+			if deleteErr := deletePublishedFile(id); deleteErr != nil {
+				logrus.WithField("published_file_id", id).Error("failed to delete unverified PublishedFile")
+			}
+			return 0, 0, err
+		}
+		if winner == 0 || winner == id {
+			return id, candidate, nil
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"name":           name,
+			"version_number": candidate,
+		}).Info("publish version number taken by a concurrent publish, retrying")
+		if err = deletePublishedFile(id); err != nil {
+			return 0, 0, err
+		}
+
+		latest, err = findLatestPublishVersionNumber(ctx, name, fileType)
+		if err != nil {
+			return 0, 0, err
+		}
+		candidate++
+		if latest >= candidate {
+			candidate = latest + 1
+		}
+		time.Sleep(versionAllocationJitter(attempt))
+	}
+
+	return 0, 0, fmt.Errorf("failed to allocate a publish version number for %v after %v attempts", name, maxVersionAllocationAttempts)
+}
+
+func createPublishedFileRecord(body map[string]interface{}) (int64, error) {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		logrus.Error("failed to marshal PublishedFile to JSON")
+		return 0, err
+	}
+
+	req, err := NewCreateRequest("PublishedFile", reqBody)
+	if err != nil {
+		logrus.Error("failed to create new PublishedFile request")
+		return 0, err
+	}
+
+	var resp PublishedFileRecordResponse
+	if err = DoCreateRequest(req, &resp); err != nil {
+		logrus.Error("failed to make new PublishedFile request")
+		return 0, err
+	}
+	return resp.Data.ID, nil
+}
+
+func deletePublishedFile(publishID int64) error {
+	req, err := NewDeleteRequest("PublishedFile", publishID)
+	if err != nil {
+		logrus.Error("failed to create PublishedFile delete request")
+		return err
+	}
+
+	if err = DoDeleteRequest(req); err != nil {
+		logrus.WithField("published_file_id", publishID).Error("failed to delete PublishedFile")
+		return err
+	}
+	return nil
+}
+
+// linkPublishVersion creates the Version of a publish and links the PublishedFile to it. The
+// Version is deleted again when the link can not be set.
+func linkPublishVersion(ctx Context, publishID int64, name string, versionNumber int64, description string) error {
+	version, err := createPublishVersion(ctx, name, versionNumber, description)
+	if err != nil {
+		logrus.WithField("name", name).Error("failed to create Version for publish")
+		return err
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"version": LinkField{ID: version.ID, Type: "Version"},
+	})
+	if err != nil {
+		logrus.WithError(err).Error("failed to create request body")
+		return err
+	}
+
+	req, err := NewUpdateRequest("PublishedFile", publishID, []string{"id", "version"}, data)
+	if err != nil {
+		logrus.Error("failed to create update PublishedFile request")
+		return err
+	}
+
+	var resp PublishedFileRecordResponse
+	if err = DoUpdateRequest(req, &resp); err != nil {
+		logrus.WithField("published_file_id", publishID).Error("failed to link Version to PublishedFile")
+		if deleteErr := deleteVersion(version.ID); deleteErr != nil {
+			logrus.WithField("version_id", version.ID).Error("failed to delete Version of failed publish")
+		}
+		return err
+	}
+	return nil
+}
+
+// publishVersionFilters matches the publishes of a stream, as defined by publishStreamFilters;
+// publishes of every Task of the entity share the version numbers.
+func publishVersionFilters(ctx Context, name string, fileType *LinkField) ShotgunFilters {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"project", "is", ctx.Project.Ref()},
+			{"name", "is", name},
+		},
+	}
+	if ctx.Entity != nil {
+		filters.Expressions = append(filters.Expressions, ShotgunFilterExpression{"entity", "is", ctx.Entity.Ref()})
+	}
+	if fileType != nil {
+		filters.Expressions = append(filters.Expressions, ShotgunFilterExpression{"published_file_type", "is", fileType.Ref()})
+	} else {
+		filters.Expressions = append(filters.Expressions, ShotgunFilterExpression{"published_file_type", "is", nil})
+	}
+	return filters
+}
+
+// findFirstPublishWithVersionNumber returns the id of the oldest publish of the stream with the
+// version number, or 0 when there is none.
+func findFirstPublishWithVersionNumber(ctx Context, name string, fileType *LinkField, versionNumber int64) (int64, error) {
+	filters := publishVersionFilters(ctx, name, fileType)
+	filters.Expressions = append(filters.Expressions, ShotgunFilterExpression{"version_number", "is", versionNumber})
+	sort := []SortParam{
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+
+	req, err := NewSearchRequest("PublishedFile", filters, []string{"id"}, &page, sort)
+	if err != nil {
+		logrus.Error("failed to create PublishedFile search request")
+		return 0, err
+	}
+
+	var resp PublishedFileMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make PublishedFile search request")
+		return 0, err
+	}
+
+	if len(resp.Data) == 0 {
+		return 0, nil
+	}
+	return resp.Data[0].ID, nil
+}
+
+// findLatestPublishVersionNumber returns the highest version number of a publish stream.
+func findLatestPublishVersionNumber(ctx Context, name string, fileType *LinkField) (int64, error) {
+	filters := publishVersionFilters(ctx, name, fileType)
+	sort := []SortParam{
+		{
+			FieldName: "version_number",
+			Direction: Descending,
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+
+	req, err := NewSearchRequest("PublishedFile", filters, []string{"id", "version_number"}, &page, sort)
+	if err != nil {
+		logrus.Error("failed to create PublishedFile search request")
+		return 0, err
+	}
+
+	var resp PublishedFileMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make PublishedFile search request")
+		return 0, err
+	}
+
+	if len(resp.Data) == 0 {
+		return 0, nil
+	}
+	return resp.Data[0].Attributes.VersionNumber, nil
+}
+
+func createPublishVersion(ctx Context, name string, versionNumber int64, description string) (*VersionData, error) {
+	body := map[string]interface{}{
+		"code":              fmt.Sprintf("%v.v%03d", name, versionNumber),
+		"project":           ctx.Project.Ref(),
+		"sg_version_number": versionNumber,
+		"description":       description,
+	}
+	if ctx.Entity != nil {
+		body["entity"] = ctx.Entity.Ref()
+	}
+	if ctx.Task != nil {
+		body["sg_task"] = ctx.Task.Ref()
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		logrus.Error("failed to marshal Version to JSON")
+		return nil, err
+	}
+
+	req, err := NewCreateRequest("Version", reqBody)
+	if err != nil {
+		logrus.Error("failed to create new Version request")
+		return nil, err
+	}
+
+	var resp VersionRecordResponse
+	if err = DoCreateRequest(req, &resp); err != nil {
+		logrus.Error("failed to make new Version request")
+		return nil, err
+	}
+
+	return &VersionData{
+		ID:     resp.Data.ID,
+		Name:   resp.Data.Attributes.Code,
+		Number: resp.Data.Attributes.VersionNumber,
+	}, nil
+}
+
+type PublishedFileTypeRecord struct {
+	ID         int64 `json:"id"`
+	Attributes struct {
+		Code string `json:"code"`
+	} `json:"attributes"`
+}
+
+type PublishedFileTypeMultiRecordResponse struct {
+	Data []PublishedFileTypeRecord `json:"data"`
+}
+
+func (t *PublishedFileTypeMultiRecordResponse) ReadRecord(data []byte) error {
+	err := json.Unmarshal(data, &t)
+	if err != nil {
+		logrus.Error("failed to unmarshal data to PublishedFileTypeMultiRecord")
+		return err
+	}
+	return nil
+}
+
+type PublishedFileTypeRecordResponse struct {
+	Data PublishedFileTypeRecord `json:"data"`
+}
+
+func (e *PublishedFileTypeRecordResponse) ReadRecord(data []byte) error {
+	if err := json.Unmarshal(data, &e); err != nil {
+		logrus.Error("failed to unmarshal PublishedFileType response")
+		return err
+	}
+	return nil
+}
+
+func GetOrCreatePublishedFileType(code string) (*LinkField, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"code", "is", code},
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+	req, err := NewSearchRequest("PublishedFileType", filters, []string{"id", "code"}, &page, nil)
+	if err != nil {
+		logrus.Error("failed to create PublishedFileType search request")
+		return nil, err
+	}
+
+	var resp PublishedFileTypeMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make PublishedFileType search request")
+		return nil, err
+	}
+
+	if len(resp.Data) > 0 {
+		return &LinkField{ID: resp.Data[0].ID, Type: "PublishedFileType", Name: resp.Data[0].Attributes.Code}, nil
+	}
+
+	reqBody, err := json.Marshal(map[string]interface{}{"code": code})
+	if err != nil {
+		logrus.Error("failed to marshal PublishedFileType to JSON")
+		return nil, err
+	}
+
+	createReq, err := NewCreateRequest("PublishedFileType", reqBody)
+	if err != nil {
+		logrus.Error("failed to create new PublishedFileType request")
+		return nil, err
+	}
+
+	var createResp PublishedFileTypeRecordResponse
+	if err = DoCreateRequest(createReq, &createResp); err != nil {
+		logrus.Error("failed to make new PublishedFileType request")
+		return nil, err
+	}
+
+	return &LinkField{ID: createResp.Data.ID, Type: "PublishedFileType", Name: code}, nil
+}
@@ -4,29 +4,43 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"sort"
 )
 
 type PublishedFileData struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Size        int64     `json:"size"`
-	CreatedAt   string    `json:"created_at"`
-	Entity      LinkField `json:"entity"`
-	Project     LinkField `json:"project"`
-	Version     LinkField `json:"version"`
-	Task        LinkField `json:"task"`
-	DownloadURI string    `json:"download_uri"`
-	WindowsFile string    `json:"windows_file"`
-	MacFile     string    `json:"mac_file"`
-	LinuxFile   string    `json:"linux_file"`
+	ID                int64       `json:"id"`
+	Name              string      `json:"name"`
+	Code              string      `json:"code"`
+	VersionNumber     int64       `json:"version_number"`
+	PublishedFileType LinkField   `json:"published_file_type"`
+	Description       string      `json:"description"`
+	Status            string      `json:"status"`
+	Upstream          []LinkField `json:"upstream_published_files"`
+	Downstream        []LinkField `json:"downstream_published_files"`
+	Size              int64       `json:"size"`
+	CreatedAt         string      `json:"created_at"`
+	Entity            LinkField   `json:"entity"`
+	Project           LinkField   `json:"project"`
+	Version           LinkField   `json:"version"`
+	Task              LinkField   `json:"task"`
+	DownloadURI       string      `json:"download_uri"`
+	WindowsFile       string      `json:"windows_file"`
+	MacFile           string      `json:"mac_file"`
+	LinuxFile         string      `json:"linux_file"`
+	PathCache         string      `json:"path_cache"`
+	LocalStorage      LinkField   `json:"local_storage"`
+	LocalPath         string      `json:"local_path"` // Path of the file on the running OS.
 }
 
 var publishedFileFields = []string{
-	"id", "created_at", "name",
+	"id", "created_at", "name", "code",
 	"entity", "project",
 	"path", "path_cache",
 	"sg_file_size", "sg_download_uri",
-	"version", "task",
+	"version", "task", "version_number",
+	"published_file_type", "description",
+	"sg_status_list", "upstream_published_files",
+	"downstream_published_files",
 }
 
 func (p *PublishedFileData) SetField(fieldName string, fieldValue interface{}) error {
@@ -70,12 +84,16 @@ type Attachment struct {
 type PublishedFileRecord struct {
 	ID         int64 `json:"id"`
 	Attributes struct {
-		Name        string     `json:"content"`
-		DownloadURI string     `json:"sg_download_uri"`
-		CreatedAt   string     `json:"created_at"`
-		Path        Attachment `json:"path"`
-		PathCache   string     `json:"path_cache"`
-		FileSize    int64      `json:"sg_file_size"`
+		Name          string     `json:"name"`
+		Code          string     `json:"code"`
+		VersionNumber int64      `json:"version_number"`
+		Description   string     `json:"description"`
+		Status        string     `json:"sg_status_list"`
+		DownloadURI   string     `json:"sg_download_uri"`
+		CreatedAt     string     `json:"created_at"`
+		Path          Attachment `json:"path"`
+		PathCache     string     `json:"path_cache"`
+		FileSize      int64      `json:"sg_file_size"`
 	} `json:"attributes"`
 	Relationships struct {
 		Version struct {
@@ -90,6 +108,15 @@ type PublishedFileRecord struct {
 		Project struct {
 			Data LinkField `json:"data"`
 		} `json:"project"`
+		PublishedFileType struct {
+			Data LinkField `json:"data"`
+		} `json:"published_file_type"`
+		Upstream struct {
+			Data []LinkField `json:"data"`
+		} `json:"upstream_published_files"`
+		Downstream struct {
+			Data []LinkField `json:"data"`
+		} `json:"downstream_published_files"`
 	} `json:"relationships"`
 }
 
@@ -131,20 +158,251 @@ func GetPublishedFileForID(publishedFileID int64) (*PublishedFileData, error) {
 		return nil, err
 	}
 
-	result := &PublishedFileData{
-		ID:          resp.Data.ID,
-		Name:        resp.Data.Attributes.Name,
-		Project:     resp.Data.Relationships.Project.Data,
-		Entity:      resp.Data.Relationships.Entity.Data,
-		Task:        resp.Data.Relationships.Task.Data,
-		Version:     resp.Data.Relationships.Version.Data,
-		CreatedAt:   resp.Data.Attributes.CreatedAt,
-		DownloadURI: resp.Data.Attributes.DownloadURI,
-		MacFile:     resp.Data.Attributes.Path.LocalPathMac,
-		WindowsFile: resp.Data.Attributes.Path.LocalPathWindows,
-		LinuxFile:   resp.Data.Attributes.Path.LocalPathLinux,
-		Size:        resp.Data.Attributes.FileSize,
+	result := []PublishedFileData{*newPublishedFileData(resp.Data)}
+	resolveLocalPaths(result)
+	return &result[0], nil
+}
+
+func newPublishedFileData(record PublishedFileRecord) *PublishedFileData {
+	return &PublishedFileData{
+		ID:                record.ID,
+		Name:              record.Attributes.Name,
+		Code:              record.Attributes.Code,
+		VersionNumber:     record.Attributes.VersionNumber,
+		PublishedFileType: record.Relationships.PublishedFileType.Data,
+		Description:       record.Attributes.Description,
+		Status:            record.Attributes.Status,
+		Upstream:          record.Relationships.Upstream.Data,
+		Downstream:        record.Relationships.Downstream.Data,
+		Project:           record.Relationships.Project.Data,
+		Entity:            record.Relationships.Entity.Data,
+		Task:              record.Relationships.Task.Data,
+		Version:           record.Relationships.Version.Data,
+		CreatedAt:         record.Attributes.CreatedAt,
+		DownloadURI:       record.Attributes.DownloadURI,
+		MacFile:           record.Attributes.Path.LocalPathMac,
+		WindowsFile:       record.Attributes.Path.LocalPathWindows,
+		LinuxFile:         record.Attributes.Path.LocalPathLinux,
+		Size:              record.Attributes.FileSize,
+		PathCache:         record.Attributes.PathCache,
+		LocalStorage:      record.Attributes.Path.LocalStorage,
+	}
+}
+
+type PublishFilter struct {
+	PublishedFileTypes []string // Codes of the PublishedFileTypes to include, all types when empty.
+	Statuses           []string // Values of sg_status_list to include, all statuses when empty.
+}
+
+func (f PublishFilter) apply(filters *ShotgunFilters) {
+	if len(f.PublishedFileTypes) > 0 {
+		filters.Expressions = append(filters.Expressions,
+			ShotgunFilterExpression{"published_file_type.PublishedFileType.code", "in", f.PublishedFileTypes},
+		)
+	}
+	if len(f.Statuses) > 0 {
+		filters.Expressions = append(filters.Expressions,
+			ShotgunFilterExpression{"sg_status_list", "in", f.Statuses},
+		)
+	}
+}
+
+func GetPublishesForTask(taskID int64, filter PublishFilter) ([]PublishedFileData, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"task.Task.id", "is", taskID},
+		},
+	}
+	filter.apply(&filters)
+
+	return searchPublishedFiles(filters)
+}
+
+func GetPublishesForEntity(entity LinkField, filter PublishFilter) ([]PublishedFileData, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"entity", "is", entity.Ref()},
+		},
+	}
+	filter.apply(&filters)
+
+	return searchPublishedFiles(filters)
+}
+
+// GetPublishStream returns every version of a publish, oldest first.
+func GetPublishStream(entity LinkField, name, publishedFileType string) ([]PublishedFileData, error) {
+	filters := publishStreamFilters(entity, name, publishedFileType)
+	return searchPublishedFiles(filters)
+}
+
+// GetLatestPublish returns the highest version of a publish, or nil when the stream is empty.
+func GetLatestPublish(entity LinkField, name, publishedFileType string) (*PublishedFileData, error) {
+	filters := publishStreamFilters(entity, name, publishedFileType)
+	sort := []SortParam{
+		{
+			FieldName: "version_number",
+			Direction: Descending,
+		},
+		{
+			FieldName: "created_at",
+			Direction: Descending,
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+	req, err := NewSearchRequest("PublishedFile", filters, publishedFileFields, &page, sort)
+	if err != nil {
+		logrus.Error("failed to create PublishedFile search request")
+		return nil, err
+	}
+
+	var resp PublishedFileMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make PublishedFile search request")
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		logrus.Info("search results contain zero PublishedFile items")
+		return nil, nil
+	}
+
+	result := []PublishedFileData{*newPublishedFileData(resp.Data[0])}
+	resolveLocalPaths(result)
+	return &result[0], nil
+}
+
+// publishStreamFilters matches the publishes of a stream. A stream is identified by its
+// entity, name and PublishedFileType, the Task is not part of it. An empty publishedFileType
+// matches the publishes without a type.
+func publishStreamFilters(entity LinkField, name, publishedFileType string) ShotgunFilters {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"entity", "is", entity.Ref()},
+			{"name", "is", name},
+		},
+	}
+	if publishedFileType != "" {
+		filters.Expressions = append(filters.Expressions,
+			ShotgunFilterExpression{"published_file_type.PublishedFileType.code", "is", publishedFileType},
+		)
+	} else {
+		filters.Expressions = append(filters.Expressions,
+			ShotgunFilterExpression{"published_file_type", "is", nil},
+		)
+	}
+	return filters
+}
+
+// publishStreamKey identifies the stream of a publish, matching publishStreamFilters.
+func publishStreamKey(publish PublishedFileData) string {
+	return fmt.Sprintf("%v/%v/%v/%v", publish.Entity.Type, publish.Entity.ID, publish.PublishedFileType.ID, publish.Name)
+}
+
+type PublishStream struct {
+	Name              string              `json:"name"`
+	Entity            LinkField           `json:"entity"`
+	PublishedFileType LinkField           `json:"published_file_type"`
+	Versions          []PublishedFileData `json:"versions"`
+}
+
+// Latest returns the highest version in the stream.
+func (p *PublishStream) Latest() *PublishedFileData {
+	if len(p.Versions) == 0 {
+		return nil
+	}
+	return &p.Versions[len(p.Versions)-1]
+}
+
+// GetPublishStreamsForEntity returns the publishes of an entity grouped by stream, i.e. by
+// name and PublishedFileType, with the versions of each stream oldest first.
+func GetPublishStreamsForEntity(entity LinkField, filter PublishFilter) ([]PublishStream, error) {
+	publishes, err := GetPublishesForEntity(entity, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return GroupPublishStreams(publishes), nil
+}
+
+func GroupPublishStreams(publishes []PublishedFileData) []PublishStream {
+	var result []PublishStream
+	index := map[string]int{}
+	for _, publish := range publishes {
+		key := publishStreamKey(publish)
+		i, ok := index[key]
+		if !ok {
+			i = len(result)
+			index[key] = i
+			result = append(result, PublishStream{
+				Name:              publish.Name,
+				Entity:            publish.Entity,
+				PublishedFileType: publish.PublishedFileType,
+			})
+		}
+		result[i].Versions = append(result[i].Versions, publish)
+	}
+
+	for i := range result {
+		sortPublishesByVersion(result[i].Versions)
+	}
+	return result
+}
+
+func sortPublishesByVersion(publishes []PublishedFileData) {
+	sort.SliceStable(publishes, func(i, j int) bool {
+		if publishes[i].VersionNumber != publishes[j].VersionNumber {
+			return publishes[i].VersionNumber < publishes[j].VersionNumber
+		}
+		return publishes[i].ID < publishes[j].ID
+	})
+}
+
+// searchPublishedFiles returns every match of the filters, oldest version first, paging until
+// a short page comes back.
+func searchPublishedFiles(filters ShotgunFilters) ([]PublishedFileData, error) {
+	sort := []SortParam{
+		{
+			FieldName: "version_number",
+			Direction: Ascending,
+		},
+		{
+			FieldName: "created_at",
+			Direction: Ascending,
+		},
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+
+	var result []PublishedFileData
+	for page := 1; ; page++ {
+		pageParam := PageParam{
+			Size:   maxSearchPageSize,
+			Number: page,
+		}
+		req, err := NewSearchRequest("PublishedFile", filters, publishedFileFields, &pageParam, sort)
+		if err != nil {
+			logrus.Error("failed to create PublishedFile search request")
+			return nil, err
+		}
+
+		var resp PublishedFileMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make PublishedFile search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, *newPublishedFileData(record))
+		}
+		if len(resp.Data) < maxSearchPageSize {
+			break
+		}
 	}
 
+	resolveLocalPaths(result)
 	return result, nil
 }
@@ -0,0 +1,265 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	ReviewStatusPending          = "rev"
+	ReviewStatusViewed           = "vwd"
+	ReviewStatusApproved         = "apr"
+	ReviewStatusChangesRequested = "chg"
+)
+
+// reviewStatusField is the Version field governed by the review workflow.
+const reviewStatusField = "sg_review_status"
+
+// AnyReviewStatus in ReviewTransition.From allows the transition from every status.
+const AnyReviewStatus = "*"
+
+type ReviewTransition struct {
+	From           []string `json:"from"`
+	To             string   `json:"to"`
+	RequiredGroups []string `json:"required_groups"` // Names of the Groups allowed to make the transition, empty for everyone.
+	CreateNote     bool     `json:"create_note"`     // Create a Note on the Version addressed to the artist.
+	TaskStatus     string   `json:"task_status"`     // Status set on the Task of the Version.
+}
+
+func (t *ReviewTransition) allowsFrom(status string) bool {
+	for _, from := range t.From {
+		if from == AnyReviewStatus || from == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *ReviewTransition) allowsActor(actor *UserData) bool {
+	if len(t.RequiredGroups) == 0 {
+		return true
+	}
+	if actor == nil {
+		return false
+	}
+	for _, group := range actor.Groups {
+		for _, required := range t.RequiredGroups {
+			if strings.EqualFold(group.Name, required) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type ReviewWorkflow struct {
+	Transitions []ReviewTransition `json:"transitions"`
+}
+
+// DefaultReviewWorkflow lets anyone mark a Version as viewed, and only supervisors approve it
+// or request changes.
+func DefaultReviewWorkflow() *ReviewWorkflow {
+	return &ReviewWorkflow{
+		Transitions: []ReviewTransition{
+			{
+				From: []string{"", ReviewStatusPending},
+				To:   ReviewStatusViewed,
+			},
+			{
+				From:           []string{"", ReviewStatusPending, ReviewStatusViewed, ReviewStatusChangesRequested},
+				To:             ReviewStatusApproved,
+				RequiredGroups: []string{"Supervisors"},
+				TaskStatus:     "apr",
+			},
+			{
+				From:           []string{"", ReviewStatusPending, ReviewStatusViewed, ReviewStatusApproved},
+				To:             ReviewStatusChangesRequested,
+				RequiredGroups: []string{"Supervisors"},
+				CreateNote:     true,
+				TaskStatus:     "ip",
+			},
+			{
+				From: []string{ReviewStatusChangesRequested},
+				To:   ReviewStatusPending,
+			},
+		},
+	}
+}
+
+var ReviewStatusWorkflow = DefaultReviewWorkflow()
+
+func LoadReviewWorkflow(path string) (*ReviewWorkflow, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logrus.WithField("path", path).Error("failed to read review workflow")
+		return nil, err
+	}
+
+	var workflow ReviewWorkflow
+	if err = json.Unmarshal(data, &workflow); err != nil {
+		logrus.WithField("path", path).Error("failed to unmarshal review workflow")
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// Find returns the transition from one status to another, or an error when the workflow does
+// not allow it.
+func (w *ReviewWorkflow) Find(from, to string) (*ReviewTransition, error) {
+	for i := range w.Transitions {
+		transition := &w.Transitions[i]
+		if transition.To == to && transition.allowsFrom(from) {
+			return transition, nil
+		}
+	}
+	return nil, fmt.Errorf("review status can not change from %q to %q", from, to)
+}
+
+// TransitionReviewStatus changes the review status of a Version with the ReviewStatusWorkflow.
+func TransitionReviewStatus(version *VersionData, to string, actor *UserData) error {
+	return ReviewStatusWorkflow.Transition(version, to, actor, "")
+}
+
+// Transition checks that the actor may move the Version to the new review status, updates it,
+// runs the side effects of the transition and records it as an EventLogEntry. The comment is
+// used as the content of the Note created by the transition. The current status is read from
+// Shotgun rather than from version, which is updated with it. Side effects that fail are
+// listed in the event and in the returned error; the status change is recorded either way.
+func (w *ReviewWorkflow) Transition(version *VersionData, to string, actor *UserData, comment string) error {
+	current, err := GetVersionForID(version.ID)
+	if err != nil {
+		logrus.WithField("version_id", version.ID).Error("failed to read current Version review status")
+		return err
+	}
+	*version = *current
+
+	from := version.ReviewStatus
+	transition, err := w.Find(from, to)
+	if err != nil {
+		return err
+	}
+	if !transition.allowsActor(actor) {
+		login := ""
+		if actor != nil {
+			login = actor.Login
+		}
+		return fmt.Errorf("user %q is not allowed to change review status to %q, requires one of the groups %v", login, to, transition.RequiredGroups)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		reviewStatusField: to,
+	})
+	if err != nil {
+		logrus.WithError(err).Error("failed to create request body")
+		return err
+	}
+
+	req, err := NewUpdateRequest("Version", version.ID, VersionFields, data)
+	if err != nil {
+		logrus.Error("failed to create update Version request")
+		return err
+	}
+
+	var resp VersionRecordResponse
+	if err = DoUpdateRequest(req, &resp); err != nil {
+		logrus.WithField("version_id", version.ID).Error("failed to update Version review status")
+		return err
+	}
+	version.ReviewStatus = to
+
+	logger := logrus.WithFields(logrus.Fields{
+		"version_id": version.ID,
+		"from":       from,
+		"to":         to,
+	})
+
+	var failed []string
+	if transition.CreateNote {
+		if err = createReviewNote(version, from, to, actor, comment); err != nil {
+			logger.WithError(err).Error("failed to create review Note")
+			failed = append(failed, fmt.Sprintf("review Note: %v", err))
+		}
+	}
+
+	if transition.TaskStatus != "" && version.Task.ID > 0 {
+		task := TaskData{ID: version.Task.ID}
+		if err = task.SetField("sg_status_list", transition.TaskStatus); err != nil {
+			logger.WithError(err).Error("failed to update Task status")
+			failed = append(failed, fmt.Sprintf("Task %v status: %v", version.Task.ID, err))
+		}
+	}
+
+	event := EventData{
+		EventType:   "API_Version_ReviewStatus_Change",
+		Description: fmt.Sprintf("%v changed review status of %v from %q to %q", actorName(actor), version.Name, from, to),
+		Entity:      LinkField{ID: version.ID, Type: "Version"},
+		Project:     version.Project.Ref(),
+		Metadata: map[string]interface{}{
+			"attribute_name": reviewStatusField,
+			"old_value":      from,
+			"new_value":      to,
+		},
+	}
+	if actor != nil {
+		event.Metadata["user"] = LinkField{ID: actor.ID, Type: "HumanUser"}
+	}
+	if len(failed) > 0 {
+		event.Metadata["failed_side_effects"] = failed
+	}
+	if err = NewEvent(&event); err != nil {
+		logger.WithError(err).Error("failed to record review status event")
+		failed = append(failed, fmt.Sprintf("event: %v", err))
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("review status of Version %v changed from %q to %q, but %v", version.ID, from, to, failed)
+	}
+	return nil
+}
+
+func createReviewNote(version *VersionData, from, to string, actor *UserData, comment string) error {
+	links := []LinkField{{ID: version.ID, Type: "Version"}}
+	if version.Entity.ID > 0 {
+		links = append(links, version.Entity)
+	}
+	if version.Task.ID > 0 {
+		links = append(links, version.Task)
+	}
+
+	content := comment
+	if content == "" {
+		content = fmt.Sprintf("Review status changed from %q to %q.", from, to)
+	}
+
+	opts := NoteOptions{
+		Subject:        fmt.Sprintf("%v: %v", version.Name, to),
+		Content:        content,
+		Project:        version.Project,
+		Links:          links,
+		IgnoreMentions: comment == "",
+	}
+	if actor != nil {
+		author := actor.Link()
+		opts.Author = &author
+	}
+
+	if version.User.ID > 0 {
+		opts.To = []LinkField{version.User}
+	}
+
+	_, err := CreateNote(opts)
+	return err
+}
+
+func actorName(actor *UserData) string {
+	if actor == nil {
+		return "Script"
+	}
+	if name := actor.DisplayName(); name != "" {
+		return name
+	}
+	return actor.Login
+}
@@ -2,6 +2,7 @@ package shotgun_api
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/sirupsen/logrus"
 )
 
@@ -54,6 +55,31 @@ func (t *SequenceMultiRecordResponse) ReadRecord(data []byte) error {
 	return nil
 }
 
+func GetSequenceForID(sequenceID int64) (*SequenceData, error) {
+	req, err := NewFindRequest("Sequence", sequenceID, sequenceFields)
+	if err != nil {
+		logrus.Error("failed to create Sequence find request")
+		return nil, err
+	}
+
+	var resp SequenceRecordResponse
+	if err = DoFindRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Sequence find request")
+		return nil, err
+	}
+
+	result := &SequenceData{
+		ID:     resp.Data.ID,
+		Name:   resp.Data.Attributes.Code,
+		Status: resp.Data.Attributes.Status,
+	}
+	for _, item := range resp.Data.Relationships.Shots.Data {
+		result.Shots = append(result.Shots, item.ID)
+	}
+
+	return result, nil
+}
+
 func GetSequences(projectID int64, sortBy []SortParam) ([]SequenceData, error) {
 	filters := ShotgunFilters{
 		Expressions: []ShotgunFilterExpression{
@@ -92,3 +118,36 @@ func GetSequences(projectID int64, sortBy []SortParam) ([]SequenceData, error) {
 
 	return result, nil
 }
+
+func GetSequenceByCode(projectID int64, code string) (*SequenceData, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"project.Project.id", "is", projectID},
+			{"code", "is", code},
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+	req, err := NewSearchRequest("Sequence", filters, []string{"id", "code", "sg_status_list"}, &page, nil)
+	if err != nil {
+		logrus.Error("failed to create Sequence search request")
+		return nil, err
+	}
+
+	var resp SequenceMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Sequence search request")
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no Sequences found with code: %v", code)
+	}
+
+	return &SequenceData{
+		ID:     resp.Data[0].ID,
+		Name:   resp.Data[0].Attributes.Code,
+		Status: resp.Data[0].Attributes.Status,
+	}, nil
+}
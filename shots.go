@@ -2,6 +2,7 @@ package shotgun_api
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/sirupsen/logrus"
 )
 
@@ -127,3 +128,45 @@ func GetShots(sequenceID int64, sortBy []SortParam) ([]ShotData, error) {
 
 	return result, nil
 }
+
+func GetShotByCode(projectID int64, code string) (*ShotData, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"project.Project.id", "is", projectID},
+			{"code", "is", code},
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+	req, err := NewSearchRequest("Shot", filters, shotFields, &page, nil)
+	if err != nil {
+		logrus.Error("failed to create Shot search request")
+		return nil, err
+	}
+
+	var resp ShotMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Shot search request")
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no Shots found with code: %v", code)
+	}
+
+	result := &ShotData{
+		ID:       resp.Data[0].ID,
+		Name:     resp.Data[0].Attributes.Code,
+		Status:   resp.Data[0].Attributes.Status,
+		Sequence: resp.Data[0].Relationships.Sequence.Data.Name,
+	}
+
+	var assets []int64
+	for _, ass := range resp.Data[0].Relationships.Assets.Data {
+		assets = append(assets, ass.ID)
+	}
+	result.Assets = assets
+
+	return result, nil
+}
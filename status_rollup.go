@@ -0,0 +1,452 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+type RollupMatch string
+
+const (
+	RollupAll RollupMatch = "all" // Every child status is one of the rule statuses.
+	RollupAny RollupMatch = "any" // At least one child status is one of the rule statuses.
+)
+
+type RollupRule struct {
+	Match    RollupMatch `json:"match"`
+	Statuses []string    `json:"statuses"`
+	Result   string      `json:"result"`
+}
+
+func (r *RollupRule) matches(statuses []string) bool {
+	for _, status := range statuses {
+		found := containsString(r.Statuses, status)
+		if r.Match == RollupAny && found {
+			return true
+		}
+		if r.Match == RollupAll && !found {
+			return false
+		}
+	}
+	return r.Match == RollupAll
+}
+
+// RollupRules computes the status of a parent from the statuses of its children. The first
+// matching rule wins, and Default is used when none match.
+type RollupRules struct {
+	Rules   []RollupRule `json:"rules"`
+	Ignore  []string     `json:"ignore"` // Child statuses left out, e.g. omitted Tasks.
+	Default string       `json:"default"`
+}
+
+// Apply returns the rolled up status, or false when there are no child statuses to roll up.
+func (r *RollupRules) Apply(statuses []string) (string, bool) {
+	var considered []string
+	for _, status := range statuses {
+		if status != "" && !containsString(r.Ignore, status) {
+			considered = append(considered, status)
+		}
+	}
+	if len(considered) == 0 {
+		return "", false
+	}
+
+	for i := range r.Rules {
+		if r.Rules[i].matches(considered) {
+			return r.Rules[i].Result, true
+		}
+	}
+	return r.Default, r.Default != ""
+}
+
+type RollupConfig struct {
+	Entity       RollupRules `json:"entity"`        // Tasks to Shots and Assets.
+	Sequence     RollupRules `json:"sequence"`      // Shots to Sequences.
+	Project      RollupRules `json:"project"`       // Sequences and Assets to the Project.
+	ProjectField string      `json:"project_field"` // Project field written back, the Project rollup is only reported when empty.
+}
+
+func defaultRollupRules() RollupRules {
+	return RollupRules{
+		Rules: []RollupRule{
+			{Match: RollupAll, Statuses: []string{"fin"}, Result: "fin"},
+			{Match: RollupAny, Statuses: []string{"ip", "rev"}, Result: "ip"},
+			{Match: RollupAll, Statuses: []string{"wtg"}, Result: "wtg"},
+		},
+		Ignore:  []string{"omt", "na"},
+		Default: "ip",
+	}
+}
+
+func DefaultRollupConfig() RollupConfig {
+	return RollupConfig{
+		Entity:   defaultRollupRules(),
+		Sequence: defaultRollupRules(),
+		Project:  defaultRollupRules(),
+	}
+}
+
+type RollupChange struct {
+	Entity LinkField `json:"entity"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+}
+
+type RollupReport struct {
+	DryRun    bool           `json:"dry_run"`
+	Changes   []RollupChange `json:"changes"`
+	Unchanged int            `json:"unchanged"`
+}
+
+// String formats the report as a diff, one line per changed entity.
+func (r *RollupReport) String() string {
+	var builder strings.Builder
+	if r.DryRun {
+		builder.WriteString("dry run, nothing written\n")
+	}
+	for _, change := range r.Changes {
+		builder.WriteString(fmt.Sprintf("~ %v %v (%v): %q -> %q\n", change.Entity.Type, change.Entity.Name, change.Entity.ID, change.From, change.To))
+	}
+	builder.WriteString(fmt.Sprintf("%v changed, %v unchanged\n", len(r.Changes), r.Unchanged))
+	return builder.String()
+}
+
+type StatusRollup struct {
+	Config RollupConfig
+	DryRun bool // Only report the changes.
+}
+
+func NewStatusRollup(dryRun bool) *StatusRollup {
+	return &StatusRollup{
+		Config: DefaultRollupConfig(),
+		DryRun: dryRun,
+	}
+}
+
+// rollupNode is an entity whose status is rolled up from its children.
+type rollupNode struct {
+	entity LinkField
+	status string
+}
+
+func (s *StatusRollup) RollupShot(shotID int64) (*RollupReport, error) {
+	shot, err := GetShotForID(shotID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := GetTasksForEntities([]LinkField{{ID: shotID, Type: "Shot"}})
+	if err != nil {
+		logrus.WithField("shot_id", shotID).Error("failed to retrieve Shot Tasks")
+		return nil, err
+	}
+
+	report := &RollupReport{DryRun: s.DryRun}
+	node := rollupNode{entity: LinkField{ID: shot.ID, Type: "Shot", Name: shot.Name}, status: shot.Status}
+	s.rollup(report, node, s.Config.Entity, taskStatuses(tasks))
+	return report, s.apply(report)
+}
+
+func (s *StatusRollup) RollupAsset(assetID int64) (*RollupReport, error) {
+	asset, err := GetAssetForID(assetID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := GetTasksForEntities([]LinkField{{ID: assetID, Type: "Asset"}})
+	if err != nil {
+		logrus.WithField("asset_id", assetID).Error("failed to retrieve Asset Tasks")
+		return nil, err
+	}
+
+	report := &RollupReport{DryRun: s.DryRun}
+	node := rollupNode{entity: LinkField{ID: asset.ID, Type: "Asset", Name: asset.Name}, status: asset.Status}
+	s.rollup(report, node, s.Config.Entity, taskStatuses(tasks))
+	return report, s.apply(report)
+}
+
+// RollupSequence rolls up the Tasks of every Shot of a Sequence, then the Shots to the
+// Sequence.
+func (s *StatusRollup) RollupSequence(sequenceID int64) (*RollupReport, error) {
+	sequence, err := GetSequenceForID(sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	shots, err := searchRollupShots(ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"sg_sequence.Sequence.id", "is", sequenceID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RollupReport{DryRun: s.DryRun}
+	shotStatuses, err := s.rollupFromTasks(report, shotNodes(shots))
+	if err != nil {
+		return nil, err
+	}
+
+	node := rollupNode{entity: LinkField{ID: sequence.ID, Type: "Sequence", Name: sequence.Name}, status: sequence.Status}
+	s.rollup(report, node, s.Config.Sequence, shotStatuses)
+	return report, s.apply(report)
+}
+
+// RollupProject rolls up every Shot and Asset from its Tasks, the Shots to their Sequences,
+// and the Sequences, the Shots without a Sequence and the Assets to the Project.
+func (s *StatusRollup) RollupProject(projectID int64) (*RollupReport, error) {
+	project, err := GetProjectFromID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	projectFilters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"project.Project.id", "is", projectID},
+		},
+	}
+	sequences, err := searchRollupNodes("Sequence", projectFilters)
+	if err != nil {
+		return nil, err
+	}
+	shots, err := searchRollupShots(projectFilters)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := searchRollupNodes("Asset", projectFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RollupReport{DryRun: s.DryRun}
+	shotStatuses, err := s.rollupFromTasks(report, shotNodes(shots))
+	if err != nil {
+		return nil, err
+	}
+
+	sequenceIDs := map[int64]bool{}
+	for _, sequence := range sequences {
+		sequenceIDs[sequence.entity.ID] = true
+	}
+	var projectStatuses []string
+	statusesBySequence := map[int64][]string{}
+	for i, shot := range shots {
+		if sequenceIDs[shot.sequenceID] {
+			statusesBySequence[shot.sequenceID] = append(statusesBySequence[shot.sequenceID], shotStatuses[i])
+		} else {
+			projectStatuses = append(projectStatuses, shotStatuses[i])
+		}
+	}
+
+	for _, node := range sequences {
+		projectStatuses = append(projectStatuses, s.rollup(report, node, s.Config.Sequence, statusesBySequence[node.entity.ID]))
+	}
+
+	assetStatuses, err := s.rollupFromTasks(report, assets)
+	if err != nil {
+		return nil, err
+	}
+	projectStatuses = append(projectStatuses, assetStatuses...)
+
+	node := rollupNode{entity: LinkField{ID: project.ID, Type: "Project", Name: project.Name}}
+	if s.Config.ProjectField != "" {
+		record, err := findGenericRecord(node.entity, []string{"id", s.Config.ProjectField})
+		if err != nil {
+			return nil, err
+		}
+		node.status = record.attribute(s.Config.ProjectField)
+		s.rollup(report, node, s.Config.Project, projectStatuses)
+	} else if status, ok := s.Config.Project.Apply(projectStatuses); ok {
+		logrus.WithFields(logrus.Fields{
+			"project_id": projectID,
+			"status":     status,
+		}).Info("Project status rollup is reported only, no project field is configured")
+	}
+
+	return report, s.apply(report)
+}
+
+// rollupFromTasks rolls up Shots or Assets once all of their Tasks are loaded, and returns
+// their statuses after the rollup.
+func (s *StatusRollup) rollupFromTasks(report *RollupReport, nodes []rollupNode) ([]string, error) {
+	var entities []LinkField
+	for _, node := range nodes {
+		entities = append(entities, node.entity)
+	}
+	tasks, err := GetTasksForEntities(entities)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := map[string][]string{}
+	for _, task := range tasks {
+		key := fmt.Sprintf("%v/%v", task.Entity.Type, task.Entity.ID)
+		statuses[key] = append(statuses[key], task.Status)
+	}
+
+	var result []string
+	for _, node := range nodes {
+		key := fmt.Sprintf("%v/%v", node.entity.Type, node.entity.ID)
+		result = append(result, s.rollup(report, node, s.Config.Entity, statuses[key]))
+	}
+	return result, nil
+}
+
+// rollup adds the change of a node to the report, and returns its status after the rollup.
+func (s *StatusRollup) rollup(report *RollupReport, node rollupNode, rules RollupRules, childStatuses []string) string {
+	status, ok := rules.Apply(childStatuses)
+	if !ok || status == node.status {
+		report.Unchanged++
+		return node.status
+	}
+
+	report.Changes = append(report.Changes, RollupChange{
+		Entity: node.entity,
+		From:   node.status,
+		To:     status,
+	})
+	return status
+}
+
+func (s *StatusRollup) apply(report *RollupReport) error {
+	if s.DryRun {
+		return nil
+	}
+
+	for _, change := range report.Changes {
+		field := "sg_status_list"
+		if change.Entity.Type == "Project" {
+			field = s.Config.ProjectField
+		}
+
+		data, err := json.Marshal(map[string]interface{}{
+			field: change.To,
+		})
+		if err != nil {
+			logrus.WithError(err).Error("failed to create request body")
+			return err
+		}
+
+		req, err := NewUpdateRequest(change.Entity.Type, change.Entity.ID, []string{"id", field}, data)
+		if err != nil {
+			logrus.Errorf("failed to create update %v request", change.Entity.Type)
+			return err
+		}
+
+		var resp GenericRecordResponse
+		if err = DoUpdateRequest(req, &resp); err != nil {
+			logrus.WithField("entity", change.Entity).Error("failed to write rolled up status")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func taskStatuses(tasks []TaskData) []string {
+	var result []string
+	for _, task := range tasks {
+		result = append(result, task.Status)
+	}
+	return result
+}
+
+// rollupShot is a Shot with the id of its Sequence, 0 when it has none.
+type rollupShot struct {
+	node       rollupNode
+	sequenceID int64
+}
+
+func shotNodes(shots []rollupShot) []rollupNode {
+	var result []rollupNode
+	for _, shot := range shots {
+		result = append(result, shot.node)
+	}
+	return result
+}
+
+// searchRollupShots returns every Shot matching the filters, paging until a short page comes
+// back.
+func searchRollupShots(filters ShotgunFilters) ([]rollupShot, error) {
+	sort := []SortParam{
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+
+	var result []rollupShot
+	for page := 1; ; page++ {
+		pageParam := PageParam{
+			Size:   maxSearchPageSize,
+			Number: page,
+		}
+		req, err := NewSearchRequest("Shot", filters, []string{"id", "code", "sg_status_list", "sg_sequence"}, &pageParam, sort)
+		if err != nil {
+			logrus.Error("failed to create Shot search request")
+			return nil, err
+		}
+
+		var resp ShotMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make Shot search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, rollupShot{
+				node: rollupNode{
+					entity: LinkField{ID: record.ID, Type: "Shot", Name: record.Attributes.Code},
+					status: record.Attributes.Status,
+				},
+				sequenceID: record.Relationships.Sequence.Data.ID,
+			})
+		}
+		if len(resp.Data) < maxSearchPageSize {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// searchRollupNodes returns every Sequence or Asset matching the filters, paging until a short
+// page comes back.
+func searchRollupNodes(entityType string, filters ShotgunFilters) ([]rollupNode, error) {
+	sort := []SortParam{
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+
+	var result []rollupNode
+	for page := 1; ; page++ {
+		pageParam := PageParam{
+			Size:   maxSearchPageSize,
+			Number: page,
+		}
+		req, err := NewSearchRequest(entityType, filters, []string{"id", "code", "sg_status_list"}, &pageParam, sort)
+		if err != nil {
+			logrus.Errorf("failed to create %v search request", entityType)
+			return nil, err
+		}
+
+		var resp GenericMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Errorf("failed to make %v search request", entityType)
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, rollupNode{
+				entity: LinkField{ID: record.ID, Type: entityType, Name: record.attribute("code")},
+				status: record.attribute("sg_status_list"),
+			})
+		}
+		if len(resp.Data) < maxSearchPageSize {
+			break
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,216 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+type LocalStorageData struct {
+	ID          int64  `json:"id"`
+	Code        string `json:"code"`
+	WindowsPath string `json:"windows_path"`
+	MacPath     string `json:"mac_path"`
+	LinuxPath   string `json:"linux_path"`
+}
+
+var localStorageFields = []string{
+	"id", "code", "windows_path", "mac_path", "linux_path",
+}
+
+type LocalStorageRecord struct {
+	ID         int64 `json:"id"`
+	Attributes struct {
+		Code        string `json:"code"`
+		WindowsPath string `json:"windows_path"`
+		MacPath     string `json:"mac_path"`
+		LinuxPath   string `json:"linux_path"`
+	} `json:"attributes"`
+}
+
+type LocalStorageMultiRecordResponse struct {
+	Data []LocalStorageRecord `json:"data"`
+}
+
+func (t *LocalStorageMultiRecordResponse) ReadRecord(data []byte) error {
+	err := json.Unmarshal(data, &t)
+	if err != nil {
+		logrus.Error("failed to unmarshal data to LocalStorageMultiRecord")
+		return err
+	}
+	return nil
+}
+
+var storageOverrideInvalidChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// StorageRootOverride returns the value of SHOTGUN_STORAGE_<NAME>, which replaces the root of
+// the storage or path template root with that name, e.g. where a render node mounts it elsewhere.
+func StorageRootOverride(name string) (string, bool) {
+	envName := "SHOTGUN_STORAGE_" + storageOverrideInvalidChars.ReplaceAllString(strings.ToUpper(name), "_")
+	value := os.Getenv(envName)
+	return value, value != ""
+}
+
+// Path returns the root of the storage for the running OS.
+func (s *LocalStorageData) Path() string {
+	if override, ok := StorageRootOverride(s.Code); ok {
+		return override
+	}
+
+	root := StorageRoot{
+		Windows: s.WindowsPath,
+		Mac:     s.MacPath,
+		Linux:   s.LinuxPath,
+	}
+	return root.Path()
+}
+
+var (
+	localStorageCache      = map[int64]LocalStorageData{}
+	localStorageCacheMutex sync.Mutex
+)
+
+func GetLocalStorages() ([]LocalStorageData, error) {
+	var filters ShotgunFilters
+	sort := []SortParam{
+		{
+			FieldName: "code",
+			Direction: Ascending,
+		},
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+
+	var result []LocalStorageData
+	for page := 1; ; page++ {
+		pageParam := PageParam{
+			Size:   maxSearchPageSize,
+			Number: page,
+		}
+		req, err := NewSearchRequest("LocalStorage", filters, localStorageFields, &pageParam, sort)
+		if err != nil {
+			logrus.Error("failed to create LocalStorage search request")
+			return nil, err
+		}
+
+		var resp LocalStorageMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make LocalStorage search request")
+			return nil, err
+		}
+
+		localStorageCacheMutex.Lock()
+		for _, record := range resp.Data {
+			storage := LocalStorageData{
+				ID:          record.ID,
+				Code:        record.Attributes.Code,
+				WindowsPath: record.Attributes.WindowsPath,
+				MacPath:     record.Attributes.MacPath,
+				LinuxPath:   record.Attributes.LinuxPath,
+			}
+			localStorageCache[storage.ID] = storage
+
+			result = append(result, storage)
+		}
+		localStorageCacheMutex.Unlock()
+		if len(resp.Data) < maxSearchPageSize {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// GetLocalStorageForID returns a LocalStorage, using the storages already fetched by
+// GetLocalStorages when possible.
+func GetLocalStorageForID(storageID int64) (*LocalStorageData, error) {
+	localStorageCacheMutex.Lock()
+	storage, ok := localStorageCache[storageID]
+	localStorageCacheMutex.Unlock()
+	if ok {
+		return &storage, nil
+	}
+
+	if _, err := GetLocalStorages(); err != nil {
+		return nil, err
+	}
+
+	localStorageCacheMutex.Lock()
+	storage, ok = localStorageCache[storageID]
+	localStorageCacheMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no LocalStorage found with id: %v", storageID)
+	}
+	return &storage, nil
+}
+
+// ResolvePublishedFilePath returns the path of a PublishedFile on the running OS. The
+// path_cache is joined to the root of its LocalStorage when both are known, otherwise the
+// per-OS path stored on the file field is used.
+func ResolvePublishedFilePath(p *PublishedFileData) (string, error) {
+	var storage *LocalStorageData
+	if p.LocalStorage.ID > 0 && p.PathCache != "" {
+		var err error
+		storage, err = GetLocalStorageForID(p.LocalStorage.ID)
+		if err != nil {
+			logrus.WithField("local_storage", p.LocalStorage).Error("failed to retrieve LocalStorage")
+			return "", err
+		}
+	}
+
+	localPath := localPublishPath(p, storage)
+	if localPath == "" {
+		return "", fmt.Errorf("PublishedFile %v has no local path for %v", p.ID, runtime.GOOS)
+	}
+	return localPath, nil
+}
+
+// resolveLocalPaths sets the LocalPath of search results, fetching the LocalStorages at most
+// once. Publishes without a local file, e.g. uploaded ones, keep an empty LocalPath.
+func resolveLocalPaths(publishes []PublishedFileData) {
+	var storages map[int64]LocalStorageData
+	for i := range publishes {
+		p := &publishes[i]
+		if p.LocalStorage.ID > 0 && p.PathCache != "" && storages == nil {
+			storages = map[int64]LocalStorageData{}
+			list, err := GetLocalStorages()
+			if err != nil {
+				logrus.WithError(err).Warn("failed to retrieve LocalStorages, using the per-OS paths of PublishedFiles")
+			}
+			for _, storage := range list {
+				storages[storage.ID] = storage
+			}
+		}
+
+		var storage *LocalStorageData
+		if found, ok := storages[p.LocalStorage.ID]; ok {
+			storage = &found
+		}
+		p.LocalPath = localPublishPath(p, storage)
+	}
+}
+
+func localPublishPath(p *PublishedFileData, storage *LocalStorageData) string {
+	if storage != nil && p.PathCache != "" {
+		if root := storage.Path(); root != "" {
+			return filepath.Join(root, filepath.FromSlash(p.PathCache))
+		}
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return p.WindowsFile
+	case "darwin":
+		return p.MacFile
+	default:
+		return p.LinuxFile
+	}
+}
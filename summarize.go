@@ -0,0 +1,106 @@
+package shotgun_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+type SummaryType string
+
+const (
+	RecordCountSummary SummaryType = "record_count"
+	CountSummary       SummaryType = "count"
+	SumSummary         SummaryType = "sum"
+	MaximumSummary     SummaryType = "maximum"
+	MinimumSummary     SummaryType = "minimum"
+	AverageSummary     SummaryType = "average"
+)
+
+type SummaryField struct {
+	Field string      `json:"field"`
+	Type  SummaryType `json:"type"`
+}
+
+type SummarizeRequest struct {
+	Filters       [][]interface{} `json:"filters"`
+	SummaryFields []SummaryField  `json:"summary_fields"`
+}
+
+type SummarizeResponse struct {
+	Data struct {
+		Summaries map[string]interface{} `json:"summaries"`
+	} `json:"data"`
+}
+
+// Int returns a summary as an integer, or zero when there were no records to summarize.
+func (s *SummarizeResponse) Int(field string) int64 {
+	value, ok := s.Data.Summaries[field].(float64)
+	if !ok {
+		return 0
+	}
+	return int64(value)
+}
+
+func NewSummarizeRequest(entityType string, filters ShotgunFilters, summaryFields []SummaryField) (*http.Request, error) {
+	url := ShotgunURL + fmt.Sprintf("/entity/%v/_summarize", entityType)
+
+	body := SummarizeRequest{
+		Filters:       filters.SerializeFilters(),
+		SummaryFields: summaryFields,
+	}
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		logrus.WithError(err).Error("failed to marshal summarize request")
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logrus.WithError(err).Error("failed to create summarize request")
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func DoSummarizeRequest(req *http.Request) (*SummarizeResponse, error) {
+	auth, err := AuthenticateShotgunScript()
+	if err != nil {
+		logrus.Error("authentication failed")
+		return nil, err
+	}
+	token := fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken)
+
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/vnd+shotgun.api3_array+json")
+	req.Header.Add("Authorization", token)
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		logrus.Error("failed to do summarize request")
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, HandleError(resp)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logrus.Error("failed to read summarize response")
+		return nil, err
+	}
+
+	var result SummarizeResponse
+	if err = json.Unmarshal(bodyBytes, &result); err != nil {
+		logrus.Error("failed to unmarshal summarize response")
+		return nil, err
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,308 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// minutesPerWorkDay converts template durations to the minutes stored in Task.duration.
+const minutesPerWorkDay = 8 * 60
+
+type TaskTemplateTask struct {
+	Name         string   `json:"name" yaml:"name"`                   // Content of the Task, unique within the template.
+	Step         string   `json:"step" yaml:"step"`                   // Short name of the pipeline Step.
+	DurationDays float64  `json:"duration_days" yaml:"duration_days"` // Work days, 8 hours each.
+	DependsOn    []string `json:"depends_on" yaml:"depends_on"`       // Names of the upstream Tasks.
+}
+
+type TaskTemplate struct {
+	EntityType string             `json:"entity_type" yaml:"entity_type"` // Shot or Asset, empty for any.
+	Tasks      []TaskTemplateTask `json:"tasks" yaml:"tasks"`
+}
+
+type TaskTemplateConfig struct {
+	Templates map[string]TaskTemplate `json:"templates" yaml:"templates"` // Keyed by template ID.
+}
+
+var TaskTemplates = &TaskTemplateConfig{}
+
+// LoadTaskTemplates reads task templates from a .json, .yml or .yaml file.
+func LoadTaskTemplates(configPath string) (*TaskTemplateConfig, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		logrus.WithField("path", configPath).Error("failed to read task template config")
+		return nil, err
+	}
+
+	var config TaskTemplateConfig
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".json":
+		err = json.Unmarshal(data, &config)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &config)
+	default:
+		return nil, fmt.Errorf("unsupported task template config format: %v", configPath)
+	}
+	if err != nil {
+		logrus.WithField("path", configPath).Error("failed to parse task template config")
+		return nil, err
+	}
+
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func (c *TaskTemplateConfig) Validate() error {
+	for id, template := range c.Templates {
+		if err := template.Validate(); err != nil {
+			return fmt.Errorf("task template %v: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (c *TaskTemplateConfig) GetTemplate(templateID string) (*TaskTemplate, error) {
+	template, ok := c.Templates[templateID]
+	if !ok {
+		return nil, fmt.Errorf("no task template with id: %v", templateID)
+	}
+	return &template, nil
+}
+
+// Validate checks that Task names are unique, and that dependencies exist and have no cycles.
+func (t *TaskTemplate) Validate() error {
+	tasks := map[string]TaskTemplateTask{}
+	for _, task := range t.Tasks {
+		if task.Name == "" {
+			return fmt.Errorf("task without a name")
+		}
+		if _, ok := tasks[task.Name]; ok {
+			return fmt.Errorf("duplicate task %q", task.Name)
+		}
+		tasks[task.Name] = task
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var walk func(name string) error
+	walk = func(name string) error {
+		state[name] = visiting
+		for _, upstream := range tasks[name].DependsOn {
+			if _, ok := tasks[upstream]; !ok {
+				return fmt.Errorf("task %q depends on unknown task %q", name, upstream)
+			}
+			switch state[upstream] {
+			case visiting:
+				return fmt.Errorf("dependency cycle between %q and %q", name, upstream)
+			case unvisited:
+				if err := walk(upstream); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, task := range t.Tasks {
+		if state[task.Name] == unvisited {
+			if err := walk(task.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type TaskTemplateResult struct {
+	Created []LinkField `json:"created"`
+	Skipped []LinkField `json:"skipped"` // Tasks of the template that already existed.
+	Linked  []LinkField `json:"linked"`  // Existing Tasks whose missing upstream links were added.
+}
+
+// ApplyTaskTemplate creates the Tasks of a template on a Shot or Asset with batch requests.
+// Tasks whose name already exists on the entity are skipped. The created Tasks are linked to
+// their upstream Tasks, existing or new; Shotgun fills in the downstream side. Existing Tasks
+// missing some of their template upstream links get them added, so applying the template
+// again repairs a previous apply that failed part way. On failure the result holds the Tasks
+// created so far.
+func ApplyTaskTemplate(entity LinkField, templateID string) (*TaskTemplateResult, error) {
+	template, err := TaskTemplates.GetTemplate(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if err = template.Validate(); err != nil {
+		return nil, fmt.Errorf("task template %v: %v", templateID, err)
+	}
+	if template.EntityType != "" && template.EntityType != entity.Type {
+		return nil, fmt.Errorf("task template %v is for %v entities, not %v", templateID, template.EntityType, entity.Type)
+	}
+
+	record, err := findGenericRecord(entity, []string{"id", "project"})
+	if err != nil {
+		return nil, err
+	}
+	project := record.link("project")
+	if project == nil {
+		return nil, fmt.Errorf("%v %v has no Project", entity.Type, entity.ID)
+	}
+
+	existing, err := GetTasksForEntities([]LinkField{entity})
+	if err != nil {
+		logrus.WithField("entity", entity).Error("failed to retrieve existing Tasks")
+		return nil, err
+	}
+
+	result := &TaskTemplateResult{}
+	tasksByName := map[string]LinkField{}
+	var existingIDs []int64
+	for _, task := range existing {
+		tasksByName[task.Name] = LinkField{ID: task.ID, Type: "Task", Name: task.Name}
+		existingIDs = append(existingIDs, task.ID)
+	}
+	upstreamByTask, err := getTaskUpstreams(existingIDs)
+	if err != nil {
+		logrus.WithField("entity", entity).Error("failed to retrieve existing Task dependencies")
+		return nil, err
+	}
+
+	steps := map[string]*StepData{}
+	var creates []BatchRequestItem
+	var toCreate []TaskTemplateTask
+	for _, task := range template.Tasks {
+		if link, ok := tasksByName[task.Name]; ok {
+			result.Skipped = append(result.Skipped, link)
+			continue
+		}
+
+		data := map[string]interface{}{
+			"content": task.Name,
+			"entity":  entity.Ref(),
+			"project": project.Ref(),
+		}
+		if task.Step != "" {
+			step, ok := steps[task.Step]
+			if !ok {
+				step, err = GetStepByShortName(entity.Type, task.Step)
+				if err != nil {
+					return nil, err
+				}
+				steps[task.Step] = step
+			}
+			data["step"] = LinkField{ID: step.ID, Type: "Step"}
+		}
+		if task.DurationDays > 0 {
+			data["duration"] = int64(task.DurationDays * minutesPerWorkDay)
+		}
+
+		creates = append(creates, BatchRequestItem{
+			RequestType: BatchCreate,
+			Entity:      "Task",
+			Data:        data,
+		})
+		toCreate = append(toCreate, task)
+	}
+
+	created, err := RunBatch(creates)
+	for i, record := range created {
+		link := LinkField{ID: record.ID, Type: "Task", Name: toCreate[i].Name}
+		tasksByName[link.Name] = link
+		result.Created = append(result.Created, link)
+	}
+	if err != nil {
+		logrus.WithField("entity", entity).Error("failed to create template Tasks")
+		return result, err
+	}
+
+	// Every template Task is checked, the skipped ones may have been created by an apply that
+	// failed before linking them.
+	var updates []BatchRequestItem
+	var linked []LinkField
+	for _, task := range template.Tasks {
+		if len(task.DependsOn) == 0 {
+			continue
+		}
+
+		link := tasksByName[task.Name]
+		current := upstreamByTask[link.ID]
+		upstream := append([]LinkField{}, current...)
+		for _, name := range task.DependsOn {
+			if !containsLink(current, tasksByName[name]) {
+				upstream = append(upstream, tasksByName[name].Ref())
+			}
+		}
+		if len(upstream) == len(current) {
+			continue
+		}
+
+		updates = append(updates, BatchRequestItem{
+			RequestType: BatchUpdate,
+			Entity:      "Task",
+			RecordID:    link.ID,
+			Data: map[string]interface{}{
+				"upstream_tasks": upstream,
+			},
+		})
+		if containsLink(result.Skipped, link) {
+			linked = append(linked, link)
+		}
+	}
+
+	if _, err = RunBatch(updates); err != nil {
+		logrus.WithField("entity", entity).Error("failed to link template Task dependencies")
+		return result, err
+	}
+	result.Linked = linked
+
+	return result, nil
+}
+
+// getTaskUpstreams returns the upstream Tasks of each Task, keyed by Task id.
+func getTaskUpstreams(taskIDs []int64) (map[int64][]LinkField, error) {
+	result := map[int64][]LinkField{}
+	for start := 0; start < len(taskIDs); start += maxSearchPageSize {
+		end := start + maxSearchPageSize
+		if end > len(taskIDs) {
+			end = len(taskIDs)
+		}
+
+		filters := ShotgunFilters{
+			Expressions: []ShotgunFilterExpression{
+				{"id", "in", taskIDs[start:end]},
+			},
+		}
+		page := PageParam{
+			Size: maxSearchPageSize,
+		}
+		req, err := NewSearchRequest("Task", filters, []string{"id", "upstream_tasks"}, &page, nil)
+		if err != nil {
+			logrus.Error("failed to create Task search request")
+			return nil, err
+		}
+
+		var resp GenericMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make Task search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			for _, upstream := range record.links("upstream_tasks") {
+				result[record.ID] = append(result[record.ID], upstream.Ref())
+			}
+		}
+	}
+	return result, nil
+}
@@ -2,6 +2,7 @@ package shotgun_api
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/sirupsen/logrus"
 )
 
@@ -78,6 +79,51 @@ func (t *TaskMultiRecordResponse) ReadRecord(data []byte) error {
 	return nil
 }
 
+func newTaskData(record TaskRecord) *TaskData {
+	return &TaskData{
+		ID:         record.ID,
+		Name:       record.Attributes.Name,
+		Status:     record.Attributes.Status,
+		DueDate:    record.Attributes.DueDate,
+		NoteCount:  record.Attributes.NoteCount,
+		Project:    record.Relationships.Project.Data,
+		Entity:     record.Relationships.Entity.Data,
+		Step:       &record.Relationships.Step.Data,
+		AssignedTo: record.Relationships.AssignedTo.Data,
+		Thumbnail:  record.Attributes.Image,
+		UpdatedAt:  record.Attributes.UpdatedAt,
+	}
+}
+
+func (t *TaskData) SetField(fieldName string, fieldValue interface{}) error {
+	reqBody := map[string]interface{}{
+		fieldName: fieldValue,
+	}
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		logrus.WithError(err).Error("failed to create request body")
+		return err
+	}
+
+	fields := make([]string, 0)
+	req, err := NewUpdateRequest("Task", t.ID, fields, data)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"field_name":  fieldName,
+			"field_value": fmt.Sprintf("%v", fieldValue),
+		}).Error("failed to create request to set Task field")
+		return err
+	}
+
+	var handler TaskRecordResponse
+	if err = DoUpdateRequest(req, &handler); err != nil {
+		logrus.Error("do not complete update Task request")
+		return err
+	}
+
+	return nil
+}
+
 func GetAllTasksForUser(username string) ([]TaskData, error) {
 	user, err := GetShotgunUserByLogin(username)
 	if err != nil {
@@ -115,20 +161,7 @@ func GetAllTasksForUserID(userID int64) ([]TaskData, error) {
 
 	var result []TaskData
 	for _, record := range resp.Data {
-		task := TaskData{
-			ID:         record.ID,
-			Name:       record.Attributes.Name,
-			Status:     record.Attributes.Status,
-			DueDate:    record.Attributes.DueDate,
-			NoteCount:  record.Attributes.NoteCount,
-			Project:    record.Relationships.Project.Data,
-			Entity:     record.Relationships.Entity.Data,
-			Step:       &record.Relationships.Step.Data,
-			AssignedTo: record.Relationships.AssignedTo.Data,
-			Thumbnail:  record.Attributes.Image,
-		}
-
-		result = append(result, task)
+		result = append(result, *newTaskData(record))
 	}
 
 	return result, nil
@@ -147,20 +180,7 @@ func GetTaskFromID(taskID int64) (*TaskData, error) {
 		return nil, err
 	}
 
-	result := &TaskData{
-		ID:         resp.Data.ID,
-		Name:       resp.Data.Attributes.Name,
-		Status:     resp.Data.Attributes.Status,
-		DueDate:    resp.Data.Attributes.DueDate,
-		NoteCount:  resp.Data.Attributes.NoteCount,
-		Project:    resp.Data.Relationships.Project.Data,
-		Entity:     resp.Data.Relationships.Entity.Data,
-		Step:       &resp.Data.Relationships.Step.Data,
-		AssignedTo: resp.Data.Relationships.AssignedTo.Data,
-		Thumbnail:  resp.Data.Attributes.Image,
-	}
-
-	return result, nil
+	return newTaskData(resp.Data), nil
 }
 
 func GetTasksForAsset(assetID int64) ([]TaskData, error) {
@@ -188,21 +208,7 @@ func GetTasksForAsset(assetID int64) ([]TaskData, error) {
 	}
 	var result []TaskData
 	for _, record := range resp.Data {
-		task := TaskData{
-			ID:         record.ID,
-			Name:       record.Attributes.Name,
-			Status:     record.Attributes.Status,
-			DueDate:    record.Attributes.DueDate,
-			NoteCount:  record.Attributes.NoteCount,
-			Project:    record.Relationships.Project.Data,
-			Entity:     record.Relationships.Entity.Data,
-			Step:       &record.Relationships.Step.Data,
-			AssignedTo: record.Relationships.AssignedTo.Data,
-			Thumbnail:  record.Attributes.Image,
-			UpdatedAt:  record.Attributes.UpdatedAt,
-		}
-
-		result = append(result, task)
+		result = append(result, *newTaskData(record))
 	}
 
 	return result, nil
@@ -234,21 +240,7 @@ func GetTasksForShot(shotID int64) ([]TaskData, error) {
 
 	var result []TaskData
 	for _, record := range resp.Data {
-		task := TaskData{
-			ID:         record.ID,
-			Name:       record.Attributes.Name,
-			Status:     record.Attributes.Status,
-			DueDate:    record.Attributes.DueDate,
-			NoteCount:  record.Attributes.NoteCount,
-			Project:    record.Relationships.Project.Data,
-			Entity:     record.Relationships.Entity.Data,
-			Step:       &record.Relationships.Step.Data,
-			AssignedTo: record.Relationships.AssignedTo.Data,
-			Thumbnail:  record.Attributes.Image,
-			UpdatedAt:  record.Attributes.UpdatedAt,
-		}
-
-		result = append(result, task)
+		result = append(result, *newTaskData(record))
 	}
 
 	return result, nil
@@ -280,11 +272,25 @@ func (e *StepRecordResponse) ReadRecord(data []byte) error {
 	return nil
 }
 
-func GetStepForID(stepID int64) (*StepData, error) {
-	fields := []string{
-		"id", "code", "short_name",
+var stepFields = []string{
+	"id", "code", "short_name",
+}
+
+type StepMultiRecordResponse struct {
+	Data []StepRecord `json:"data"`
+}
+
+func (t *StepMultiRecordResponse) ReadRecord(data []byte) error {
+	err := json.Unmarshal(data, &t)
+	if err != nil {
+		logrus.Error("failed to unmarshal data to StepMultiRecord")
+		return err
 	}
-	req, err := NewFindRequest("Step", stepID, fields)
+	return nil
+}
+
+func GetStepForID(stepID int64) (*StepData, error) {
+	req, err := NewFindRequest("Step", stepID, stepFields)
 	if err != nil {
 		logrus.Error("failed to create Step find request")
 		return nil, err
@@ -304,3 +310,88 @@ func GetStepForID(stepID int64) (*StepData, error) {
 
 	return result, nil
 }
+
+// GetStepByShortName finds the pipeline Step with the short name for an entity type, e.g. Shot.
+func GetStepByShortName(entityType, shortName string) (*StepData, error) {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"short_name", "is", shortName},
+			{"entity_type", "is", entityType},
+		},
+	}
+	page := PageParam{
+		Size: 1,
+	}
+	req, err := NewSearchRequest("Step", filters, stepFields, &page, nil)
+	if err != nil {
+		logrus.Error("failed to create Step search request")
+		return nil, err
+	}
+
+	var resp StepMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Step search request")
+		return nil, err
+	}
+
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no %v Steps found with short name: %v", entityType, shortName)
+	}
+
+	return &StepData{
+		ID:        resp.Data[0].ID,
+		LongName:  resp.Data[0].Attributes.Code,
+		ShortName: resp.Data[0].Attributes.ShortName,
+	}, nil
+}
+
+// GetTasksForEntities returns every Task of many Shots, Assets or other entities. The
+// entities are searched 500 at a time, and each search is paged until a short page comes back.
+func GetTasksForEntities(entities []LinkField) ([]TaskData, error) {
+	sort := []SortParam{
+		{
+			FieldName: "id",
+			Direction: Ascending,
+		},
+	}
+
+	var result []TaskData
+	for start := 0; start < len(entities); start += maxSearchPageSize {
+		end := start + maxSearchPageSize
+		if end > len(entities) {
+			end = len(entities)
+		}
+
+		filters := ShotgunFilters{
+			Expressions: []ShotgunFilterExpression{
+				{"entity", "in", linkRefs(entities[start:end])},
+			},
+		}
+		for page := 1; ; page++ {
+			pageParam := PageParam{
+				Size:   maxSearchPageSize,
+				Number: page,
+			}
+			req, err := NewSearchRequest("Task", filters, taskFields, &pageParam, sort)
+			if err != nil {
+				logrus.Error("failed to create Task search request")
+				return nil, err
+			}
+
+			var resp TaskMultiRecordResponse
+			if err = DoSearchRequest(req, &resp); err != nil {
+				logrus.Error("failed to make Task search request")
+				return nil, err
+			}
+
+			for _, record := range resp.Data {
+				result = append(result, *newTaskData(record))
+			}
+			if len(resp.Data) < maxSearchPageSize {
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,375 @@
+package shotgun_api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type StorageRoot struct {
+	Windows string `json:"windows" yaml:"windows"`
+	Mac     string `json:"mac" yaml:"mac"`
+	Linux   string `json:"linux" yaml:"linux"`
+}
+
+// Path returns the root for the running OS.
+func (r StorageRoot) Path() string {
+	switch runtime.GOOS {
+	case "windows":
+		return r.Windows
+	case "darwin":
+		return r.Mac
+	default:
+		return r.Linux
+	}
+}
+
+type PathTemplateDefinition struct {
+	Root       string `json:"root" yaml:"root"`             // Name of the storage root the definition is relative to.
+	Definition string `json:"definition" yaml:"definition"` // Path with named keys, e.g. {Shot}/{Step}/v{version:03d}.
+}
+
+type ProjectTemplateConfig struct {
+	Roots     map[string]StorageRoot            `json:"roots" yaml:"roots"`
+	Templates map[string]PathTemplateDefinition `json:"templates" yaml:"templates"`
+}
+
+type PathTemplateConfig struct {
+	Roots     map[string]StorageRoot            `json:"roots" yaml:"roots"`
+	Templates map[string]PathTemplateDefinition `json:"templates" yaml:"templates"`
+	Projects  map[string]ProjectTemplateConfig  `json:"projects" yaml:"projects"` // Per-project overrides, keyed by Project name.
+}
+
+const (
+	PrimaryStorageRoot   = "primary"
+	ShotPublishTemplate  = "shot_publish"
+	AssetPublishTemplate = "asset_publish"
+)
+
+// DefaultPathTemplateConfig describes the layout used before templates were configurable.
+func DefaultPathTemplateConfig() *PathTemplateConfig {
+	return &PathTemplateConfig{
+		Roots: map[string]StorageRoot{
+			PrimaryStorageRoot: {
+				Windows: "O:\\projects",
+				Mac:     "/Volumes/prod/projects",
+				Linux:   "/prod/projects",
+			},
+		},
+		Templates: map[string]PathTemplateDefinition{
+			ShotPublishTemplate: {
+				Root:       PrimaryStorageRoot,
+				Definition: "{Project}/production/sequences/{Sequence}/{Shot}/{Step}/publish/v{version:03d}",
+			},
+			AssetPublishTemplate: {
+				Root:       PrimaryStorageRoot,
+				Definition: "{Project}/production/assets/{AssetType}/{Asset}/{Step}/publish/v{version:03d}",
+			},
+		},
+	}
+}
+
+var PathTemplates = DefaultPathTemplateConfig()
+
+// LoadPathTemplates reads a template config from a .json, .yml or .yaml file.
+func LoadPathTemplates(configPath string) (*PathTemplateConfig, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		logrus.WithField("path", configPath).Error("failed to read path template config")
+		return nil, err
+	}
+
+	var config PathTemplateConfig
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".json":
+		err = json.Unmarshal(data, &config)
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &config)
+	default:
+		return nil, fmt.Errorf("unsupported path template config format: %v", configPath)
+	}
+	if err != nil {
+		logrus.WithField("path", configPath).Error("failed to parse path template config")
+		return nil, err
+	}
+
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func (c *PathTemplateConfig) Validate() error {
+	for name, def := range c.Templates {
+		if _, err := parseTemplateKeys(def.Definition); err != nil {
+			return fmt.Errorf("template %v: %v", name, err)
+		}
+	}
+	for projectName, project := range c.Projects {
+		for name, def := range project.Templates {
+			if _, err := parseTemplateKeys(def.Definition); err != nil {
+				return fmt.Errorf("project %v template %v: %v", projectName, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RootPath returns the path of a storage root for the running OS, preferring the roots
+// configured for the project. SHOTGUN_STORAGE_<NAME> overrides the configured path.
+func (c *PathTemplateConfig) RootPath(projectName, rootName string) (string, error) {
+	root, ok := c.Projects[projectName].Roots[rootName]
+	if !ok {
+		root, ok = c.Roots[rootName]
+	}
+	if !ok {
+		return "", fmt.Errorf("no storage root named %v", rootName)
+	}
+
+	rootPath := root.Path()
+	if override, ok := StorageRootOverride(rootName); ok {
+		rootPath = override
+	}
+	if rootPath == "" {
+		return "", fmt.Errorf("storage root %v has no path for %v", rootName, runtime.GOOS)
+	}
+	return rootPath, nil
+}
+
+// GetTemplate returns a named template, preferring the templates configured for the project.
+func (c *PathTemplateConfig) GetTemplate(projectName, templateName string) (*PathTemplate, error) {
+	def, ok := c.Projects[projectName].Templates[templateName]
+	if !ok {
+		def, ok = c.Templates[templateName]
+	}
+	if !ok {
+		return nil, fmt.Errorf("no path template named %v", templateName)
+	}
+
+	rootPath, err := c.RootPath(projectName, def.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := parseTemplateKeys(def.Definition)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PathTemplate{
+		Name:       templateName,
+		Root:       rootPath,
+		Definition: def.Definition,
+		keys:       keys,
+	}, nil
+}
+
+type PathTemplate struct {
+	Name       string `json:"name"`
+	Root       string `json:"root"`
+	Definition string `json:"definition"`
+	keys       []templateKey
+}
+
+type templateKey struct {
+	Name   string
+	Format string
+	start  int
+	end    int
+}
+
+var templateKeyPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(?::([0-9]*d))?\}`)
+
+func parseTemplateKeys(definition string) ([]templateKey, error) {
+	if strings.Count(definition, "{") != strings.Count(definition, "}") {
+		return nil, fmt.Errorf("unbalanced braces in template definition: %v", definition)
+	}
+
+	var keys []templateKey
+	for _, match := range templateKeyPattern.FindAllStringSubmatchIndex(definition, -1) {
+		key := templateKey{
+			Name:  definition[match[2]:match[3]],
+			start: match[0],
+			end:   match[1],
+		}
+		if match[4] >= 0 {
+			key.Format = definition[match[4]:match[5]]
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) != strings.Count(definition, "{") {
+		return nil, fmt.Errorf("invalid key in template definition: %v", definition)
+	}
+
+	return keys, nil
+}
+
+// Keys returns the names of the fields used by the template.
+func (t *PathTemplate) Keys() []string {
+	var result []string
+	for _, key := range t.keys {
+		result = append(result, key.Name)
+	}
+	return result
+}
+
+// Apply builds an absolute path from the template and a value for each of its keys. Keys with
+// an integer format require an integer value.
+func (t *PathTemplate) Apply(fields map[string]interface{}) (string, error) {
+	var builder strings.Builder
+	last := 0
+	for _, key := range t.keys {
+		value, ok := fields[key.Name]
+		if !ok {
+			return "", fmt.Errorf("template %v requires field %v", t.Name, key.Name)
+		}
+
+		builder.WriteString(t.Definition[last:key.start])
+		if key.Format != "" {
+			number, ok := templateInteger(value)
+			if !ok {
+				return "", fmt.Errorf("template %v requires an integer for field %v, got %v (%T)", t.Name, key.Name, value, value)
+			}
+			builder.WriteString(fmt.Sprintf("%"+key.Format, number))
+		} else {
+			builder.WriteString(fmt.Sprintf("%v", value))
+		}
+		last = key.end
+	}
+	builder.WriteString(t.Definition[last:])
+
+	return filepath.Join(t.Root, filepath.FromSlash(builder.String())), nil
+}
+
+// templateInteger converts the value of an integer template key. Whole floats are accepted, as
+// numbers decoded from JSON are float64.
+func templateInteger(value interface{}) (int64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == math.Trunc(f) {
+			return int64(f), true
+		}
+	}
+	return 0, false
+}
+
+// Parse extracts the value of each template key from an absolute path. Keys with an integer
+// format are returned as int64, all other keys as strings.
+func (t *PathTemplate) Parse(path string) (map[string]interface{}, error) {
+	relPath, ok := trimRoot(path, t.Root)
+	if !ok {
+		return nil, fmt.Errorf("path %v is not under template %v root %v", path, t.Name, t.Root)
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, key := range t.keys {
+		pattern.WriteString(regexp.QuoteMeta(t.Definition[last:key.start]))
+		if key.Format != "" {
+			pattern.WriteString(`([0-9]+)`)
+		} else {
+			pattern.WriteString(`([^/]+)`)
+		}
+		last = key.end
+	}
+	pattern.WriteString(regexp.QuoteMeta(t.Definition[last:]))
+	pattern.WriteString("$")
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, err
+	}
+
+	match := re.FindStringSubmatch(relPath)
+	if match == nil {
+		return nil, fmt.Errorf("path %v does not match template %v", path, t.Name)
+	}
+
+	fields := map[string]interface{}{}
+	for i, key := range t.keys {
+		var value interface{} = match[i+1]
+		if key.Format != "" {
+			number, err := strconv.ParseInt(match[i+1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			value = number
+		}
+
+		if previous, ok := fields[key.Name]; ok && previous != value {
+			return nil, fmt.Errorf("path %v has conflicting values for %v", path, key.Name)
+		}
+		fields[key.Name] = value
+	}
+
+	return fields, nil
+}
+
+func trimRoot(path, root string) (string, bool) {
+	path = filepath.ToSlash(filepath.Clean(path))
+	root = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(root)), "/")
+
+	prefix := path
+	if len(prefix) > len(root) {
+		prefix = prefix[:len(root)]
+	}
+	if runtime.GOOS == "windows" {
+		if !strings.EqualFold(prefix, root) {
+			return "", false
+		}
+	} else if prefix != root {
+		return "", false
+	}
+
+	rest := path[len(prefix):]
+	if !strings.HasPrefix(rest, "/") {
+		return "", false
+	}
+	return strings.TrimPrefix(rest, "/"), true
+}
+
+// ProjectTemplates returns every template that applies to the project sorted by name, with the
+// project overrides in place of the global templates of the same name.
+func (c *PathTemplateConfig) ProjectTemplates(projectName string) []*PathTemplate {
+	var names []string
+	seen := map[string]bool{}
+	for name := range c.Projects[projectName].Templates {
+		names = append(names, name)
+		seen[name] = true
+	}
+	for name := range c.Templates {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var result []*PathTemplate
+	for _, name := range names {
+		template, err := c.GetTemplate(projectName, name)
+		if err != nil {
+			logrus.WithError(err).WithField("template", name).Debug("skipping unusable path template")
+			continue
+		}
+		result = append(result, template)
+	}
+	return result
+}
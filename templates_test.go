@@ -0,0 +1,192 @@
+package shotgun_api
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testShotDefinition = "{Project}/sequences/{Sequence}/{Shot}/{Step}/v{version:03d}/{Shot}_v{version:03d}.exr"
+
+func newTestTemplate(t *testing.T, root, definition string) *PathTemplate {
+	keys, err := parseTemplateKeys(definition)
+	if err != nil {
+		t.Fatalf("parseTemplateKeys(%q): %v", definition, err)
+	}
+	return &PathTemplate{Name: "test", Root: filepath.FromSlash(root), Definition: definition, keys: keys}
+}
+
+func TestPathTemplateApply(t *testing.T) {
+	template := newTestTemplate(t, "/prod/projects", testShotDefinition)
+	shotFields := func(version interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"Project":  "demo",
+			"Sequence": "sq010",
+			"Shot":     "sh0010",
+			"Step":     "comp",
+			"version":  version,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		fields  map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{"int version", shotFields(5), "/prod/projects/demo/sequences/sq010/sh0010/comp/v005/sh0010_v005.exr", false},
+		{"int64 version", shotFields(int64(12)), "/prod/projects/demo/sequences/sq010/sh0010/comp/v012/sh0010_v012.exr", false},
+		{"whole float version", shotFields(float64(7)), "/prod/projects/demo/sequences/sq010/sh0010/comp/v007/sh0010_v007.exr", false},
+		{"wide version", shotFields(1234), "/prod/projects/demo/sequences/sq010/sh0010/comp/v1234/sh0010_v1234.exr", false},
+		{"string version", shotFields("5"), "", true},
+		{"fractional version", shotFields(1.5), "", true},
+		{"missing field", map[string]interface{}{"Project": "demo"}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := template.Apply(test.fields)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Apply() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply(): %v", err)
+			}
+			if want := filepath.FromSlash(test.want); got != want {
+				t.Errorf("Apply() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPathTemplateParse(t *testing.T) {
+	template := newTestTemplate(t, "/prod/projects", testShotDefinition)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "match",
+			path: "/prod/projects/demo/sequences/sq010/sh0010/comp/v005/sh0010_v005.exr",
+			want: map[string]interface{}{
+				"Project":  "demo",
+				"Sequence": "sq010",
+				"Shot":     "sh0010",
+				"Step":     "comp",
+				"version":  int64(5),
+			},
+		},
+		{name: "conflicting repeated key", path: "/prod/projects/demo/sequences/sq010/sh0010/comp/v005/sh0020_v005.exr", wantErr: true},
+		{name: "conflicting repeated version", path: "/prod/projects/demo/sequences/sq010/sh0010/comp/v005/sh0010_v006.exr", wantErr: true},
+		{name: "non-integer version", path: "/prod/projects/demo/sequences/sq010/sh0010/comp/vabc/sh0010_vabc.exr", wantErr: true},
+		{name: "key spanning folders", path: "/prod/projects/demo/sequences/sq010/extra/sh0010/comp/v005/sh0010_v005.exr", wantErr: true},
+		{name: "outside root", path: "/other/demo/sequences/sq010/sh0010/comp/v005/sh0010_v005.exr", wantErr: true},
+		{name: "parent folder", path: "/prod/projects/demo/sequences/sq010/sh0010/comp/v005", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := template.Parse(filepath.FromSlash(test.path))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Parse() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(): %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Parse() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPathTemplateApplyParseRoundTrip(t *testing.T) {
+	template := newTestTemplate(t, "/prod/projects", testShotDefinition)
+	fields := map[string]interface{}{
+		"Project":  "demo",
+		"Sequence": "sq010",
+		"Shot":     "sh0010",
+		"Step":     "comp",
+		"version":  int64(42),
+	}
+
+	path, err := template.Apply(fields)
+	if err != nil {
+		t.Fatalf("Apply(): %v", err)
+	}
+	got, err := template.Parse(path)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", path, err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Errorf("Parse(Apply()) = %v, want %v", got, fields)
+	}
+}
+
+func TestParseTemplateKeys(t *testing.T) {
+	tests := []struct {
+		definition string
+		want       []string
+		wantErr    bool
+	}{
+		{definition: "{Shot}/v{version:03d}", want: []string{"Shot", "version"}},
+		{definition: "static/path", want: nil},
+		{definition: "{Shot", wantErr: true},
+		{definition: "{Shot-Name}", wantErr: true},
+		{definition: "{version:03s}", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.definition, func(t *testing.T) {
+			keys, err := parseTemplateKeys(test.definition)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("parseTemplateKeys() = %v, want an error", keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTemplateKeys(): %v", err)
+			}
+			var got []string
+			for _, key := range keys {
+				got = append(got, key.Name)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseTemplateKeys() keys = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTrimRoot(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		root   string
+		want   string
+		wantOK bool
+	}{
+		{"under root", "/prod/projects/demo/shots", "/prod/projects", "demo/shots", true},
+		{"root with trailing slash", "/prod/projects/demo", "/prod/projects/", "demo", true},
+		{"unclean path", "/prod/projects/../projects/demo/./shots", "/prod/projects", "demo/shots", true},
+		{"root itself", "/prod/projects", "/prod/projects", "", false},
+		{"sibling with root prefix", "/prod/projects2/demo", "/prod/projects", "", false},
+		{"outside root", "/other/demo", "/prod/projects", "", false},
+		{"shorter than root", "/prod", "/prod/projects", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := trimRoot(filepath.FromSlash(test.path), filepath.FromSlash(test.root))
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("trimRoot(%q, %q) = %q, %v, want %q, %v", test.path, test.root, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package shotgun_api
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ThumbnailStatus int
+
+const (
+	ThumbnailMissing ThumbnailStatus = iota // The entity has no thumbnail.
+	ThumbnailPending                        // The thumbnail is still being transcoded, URL is a placeholder image.
+	ThumbnailReady
+)
+
+func (s ThumbnailStatus) String() string {
+	switch s {
+	case ThumbnailPending:
+		return "pending"
+	case ThumbnailReady:
+		return "ready"
+	default:
+		return "missing"
+	}
+}
+
+// defaultThumbnailTTL is how long a resolved thumbnail URL is cached when its expiry can not
+// be read from the URL.
+const defaultThumbnailTTL = 5 * time.Minute
+
+type ThumbnailResult struct {
+	EntityType string          `json:"entity_type"`
+	EntityID   int64           `json:"entity_id"`
+	URL        string          `json:"url"`
+	Status     ThumbnailStatus `json:"status"`
+	ExpiresAt  time.Time       `json:"expires_at"`
+}
+
+// thumbnailPlaceholderPatterns are found in the URLs of the images Shotgun serves while the
+// thumbnail of an entity is being transcoded.
+var thumbnailPlaceholderPatterns = []string{
+	"thumbnail_pending",
+	"images/status/transient",
+}
+
+func isThumbnailPlaceholder(thumbnailURL string) bool {
+	for _, pattern := range thumbnailPlaceholderPatterns {
+		if strings.Contains(thumbnailURL, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func newThumbnailResult(entityType string, entityID int64, thumbnailURL string) ThumbnailResult {
+	result := ThumbnailResult{
+		EntityType: entityType,
+		EntityID:   entityID,
+		URL:        thumbnailURL,
+	}
+	switch {
+	case thumbnailURL == "":
+		result.Status = ThumbnailMissing
+	case isThumbnailPlaceholder(thumbnailURL):
+		result.Status = ThumbnailPending
+	default:
+		result.Status = ThumbnailReady
+		if expiry, ok := signedURLExpiry(thumbnailURL); ok {
+			result.ExpiresAt = expiry
+		} else {
+			result.ExpiresAt = time.Now().Add(defaultThumbnailTTL)
+		}
+	}
+	return result
+}
+
+// ThumbnailService resolves the thumbnail URLs of entities. Ready thumbnails are cached until
+// shortly before their signed URL expires; missing and pending thumbnails are always looked up
+// again, as they can change at any time.
+type ThumbnailService struct {
+	FieldName string
+
+	mutex sync.Mutex
+	cache map[string]ThumbnailResult
+}
+
+func NewThumbnailService() *ThumbnailService {
+	return &ThumbnailService{
+		FieldName: ThumbnailField,
+		cache:     map[string]ThumbnailResult{},
+	}
+}
+
+func (s *ThumbnailService) fieldName() string {
+	if s.FieldName == "" {
+		return ThumbnailField
+	}
+	return s.FieldName
+}
+
+func thumbnailCacheKey(entityType string, entityID int64) string {
+	return fmt.Sprintf("%v/%v", entityType, entityID)
+}
+
+func (s *ThumbnailService) cached(entityType string, entityID int64) (ThumbnailResult, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, ok := s.cache[thumbnailCacheKey(entityType, entityID)]
+	if !ok {
+		return result, false
+	}
+	if time.Now().Add(urlExpiryMargin).After(result.ExpiresAt) {
+		delete(s.cache, thumbnailCacheKey(entityType, entityID))
+		return result, false
+	}
+	return result, true
+}
+
+func (s *ThumbnailService) store(result ThumbnailResult) {
+	if result.Status != ThumbnailReady {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.cache == nil {
+		s.cache = map[string]ThumbnailResult{}
+	}
+	s.cache[thumbnailCacheKey(result.EntityType, result.EntityID)] = result
+}
+
+// Invalidate drops the cached thumbnail of an entity, e.g. after uploading a new one.
+func (s *ThumbnailService) Invalidate(entityType string, entityID int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.cache, thumbnailCacheKey(entityType, entityID))
+}
+
+// Resolve returns the thumbnail of a single entity. An error is only returned when the lookup
+// itself failed; an entity without a thumbnail has the ThumbnailMissing status.
+func (s *ThumbnailService) Resolve(entityType string, entityID int64) (*ThumbnailResult, error) {
+	if result, ok := s.cached(entityType, entityID); ok {
+		return &result, nil
+	}
+
+	req, err := NewThumbnailRequest(entityID, entityType, s.fieldName())
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnailURL, err := DoGetThumbnail(req)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"entity_type": entityType,
+			"entity_id":   entityID,
+		}).Error("failed to get thumbnail URL")
+		return nil, err
+	}
+
+	result := newThumbnailResult(entityType, entityID, thumbnailURL)
+	s.store(result)
+	return &result, nil
+}
+
+// ResolveMany returns the thumbnails of many entities of the same type, looking up the ones
+// that are not cached with a single search per page of IDs. Entities that do not exist are
+// left out of the result.
+func (s *ThumbnailService) ResolveMany(entityType string, entityIDs []int64) (map[int64]ThumbnailResult, error) {
+	result := map[int64]ThumbnailResult{}
+	var missing []int64
+	seen := map[int64]bool{}
+	for _, id := range entityIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if cached, ok := s.cached(entityType, id); ok {
+			result[id] = cached
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	fields := []string{"id", s.fieldName()}
+	for start := 0; start < len(missing); start += maxSearchPageSize {
+		end := start + maxSearchPageSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		filters := ShotgunFilters{
+			Expressions: []ShotgunFilterExpression{
+				{"id", "in", missing[start:end]},
+			},
+		}
+		page := PageParam{
+			Size: maxSearchPageSize,
+		}
+		req, err := NewSearchRequest(entityType, filters, fields, &page, nil)
+		if err != nil {
+			logrus.Errorf("failed to create %v search request", entityType)
+			return nil, err
+		}
+
+		var resp GenericMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Errorf("failed to make %v thumbnail search request", entityType)
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			thumbnail := newThumbnailResult(entityType, record.ID, record.attribute(s.fieldName()))
+			s.store(thumbnail)
+			result[record.ID] = thumbnail
+		}
+	}
+
+	return result, nil
+}
@@ -26,15 +26,19 @@ func NewUpdateRequest(entityType string, entityID int64, fields []string, body [
 	return req, nil
 }
 
+// DoUpdateRequest authenticates as the script unless the request already has an
+// Authorization header, e.g. to update as a user.
 func DoUpdateRequest(req *http.Request, handler RecordResponseHandler) error {
-	auth, err := AuthenticateShotgunScript()
-	if err != nil {
-		logrus.Error("authentication failed")
-		return err
+	if req.Header.Get("Authorization") == "" {
+		auth, err := AuthenticateShotgunScript()
+		if err != nil {
+			logrus.Error("authentication failed")
+			return err
+		}
+		token := fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken)
+		req.Header.Add("Authorization", token)
 	}
 	req.Header.Add("Accept", "application/json")
-	token := fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken)
-	req.Header.Add("Authorization", token)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -0,0 +1,366 @@
+package shotgun_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DefaultUploadPartSize = 8 * 1024 * 1024
+	minUploadPartSize     = 5 * 1024 * 1024
+)
+
+type UploadProgressFunc func(sent, total int64)
+
+type UploadOptions struct {
+	DisplayName string             // Name shown for the uploaded file, defaults to the file name.
+	PartSize    int64              // Files larger than this are uploaded in parts of this size.
+	Progress    UploadProgressFunc // Called after every chunk written to the upload.
+	Session     *UploadSession     // Resumes a multipart upload that was interrupted.
+	OnPart      func(session *UploadSession)
+}
+
+func (o *UploadOptions) partSize() int64 {
+	if o.PartSize <= 0 {
+		return DefaultUploadPartSize
+	}
+	if o.PartSize < minUploadPartSize {
+		return minUploadPartSize
+	}
+	return o.PartSize
+}
+
+// UploadSession is the state of a multipart upload. It can be saved as JSON from OnPart and
+// passed back in UploadOptions.Session to continue after the last uploaded part.
+type UploadSession struct {
+	EntityType    string          `json:"entity_type"`
+	EntityID      int64           `json:"entity_id"`
+	FieldName     string          `json:"field_name"`
+	FileName      string          `json:"file_name"`
+	Size          int64           `json:"size"`
+	PartSize      int64           `json:"part_size"`
+	UploadInfo    json.RawMessage `json:"upload_info"`
+	UploadURL     string          `json:"upload_url"`
+	CompleteURL   string          `json:"complete_url"`
+	NextPartURL   string          `json:"next_part_url"`
+	ETags         []string        `json:"etags"`
+	UploadedBytes int64           `json:"uploaded_bytes"`
+}
+
+type uploadInfoResponse struct {
+	Data  json.RawMessage `json:"data"`
+	Links struct {
+		Upload         string `json:"upload"`
+		CompleteUpload string `json:"complete_upload"`
+		GetNextPart    string `json:"get_next_part"`
+	} `json:"links"`
+}
+
+type uploadInfo struct {
+	StorageService  string `json:"storage_service"`
+	MultipartUpload bool   `json:"multipart_upload"`
+}
+
+// UploadFile uploads a file from disk to a file or image field of an entity.
+func UploadFile(entityType string, entityID int64, fieldName, filePath string, opts UploadOptions) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		logrus.WithField("path", filePath).Error("failed to open file for upload")
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		logrus.WithField("path", filePath).Error("failed to stat file for upload")
+		return err
+	}
+
+	if opts.Session != nil && opts.Session.UploadedBytes > 0 {
+		if _, err = file.Seek(opts.Session.UploadedBytes, io.SeekStart); err != nil {
+			logrus.WithField("path", filePath).Error("failed to seek file to resume upload")
+			return err
+		}
+	}
+
+	return uploadReader(entityType, entityID, fieldName, filepath.Base(filePath), contentTypeForFile(filePath), file, stat.Size(), opts)
+}
+
+// uploadReader runs the upload handshake: request an upload URL, PUT the content in one or
+// more parts, then tell Shotgun the upload is complete. When resuming, r must already be
+// positioned after the bytes uploaded by the session.
+func uploadReader(entityType string, entityID int64, fieldName, fileName, contentType string, r io.Reader, size int64, opts UploadOptions) error {
+	partSize := opts.partSize()
+	session := opts.Session
+	if session == nil {
+		var err error
+		session, err = startUpload(entityType, entityID, fieldName, fileName, size, size > partSize)
+		if err != nil {
+			return err
+		}
+		session.PartSize = partSize
+	} else if session.PartSize > 0 {
+		partSize = session.PartSize
+	}
+
+	var info uploadInfo
+	if err := json.Unmarshal(session.UploadInfo, &info); err != nil {
+		logrus.Error("failed to unmarshal upload info")
+		return err
+	}
+
+	progress := func(sent int64) {
+		if opts.Progress != nil {
+			opts.Progress(sent, size)
+		}
+	}
+
+	if !info.MultipartUpload {
+		if session.UploadedBytes >= size && size > 0 {
+			logrus.WithField("file_name", fileName).Debug("upload already sent, completing it")
+		} else if _, err := putUploadPart(session.UploadURL, info.StorageService, contentType, r, size, session.UploadedBytes, progress); err != nil {
+			return err
+		}
+		session.UploadedBytes = size
+	} else {
+		for session.UploadedBytes < size {
+			partLength := size - session.UploadedBytes
+			if partLength > partSize {
+				partLength = partSize
+			}
+
+			// The session only moves to the next part once it is uploaded, so a failed part is
+			// retried with the same link when the session is resumed.
+			uploadURL, nextPartURL := session.UploadURL, session.NextPartURL
+			if len(session.ETags) > 0 {
+				var err error
+				if uploadURL, nextPartURL, err = nextUploadPart(session); err != nil {
+					return err
+				}
+			}
+
+			etag, err := putUploadPart(uploadURL, info.StorageService, contentType, io.LimitReader(r, partLength), partLength, session.UploadedBytes, progress)
+			if err != nil {
+				return err
+			}
+			session.UploadURL, session.NextPartURL = uploadURL, nextPartURL
+			session.ETags = append(session.ETags, etag)
+			session.UploadedBytes += partLength
+
+			if opts.OnPart != nil {
+				opts.OnPart(session)
+			}
+		}
+	}
+
+	displayName := opts.DisplayName
+	if displayName == "" {
+		displayName = fileName
+	}
+	return completeUpload(session, info.MultipartUpload, displayName)
+}
+
+func startUpload(entityType string, entityID int64, fieldName, fileName string, size int64, multipart bool) (*UploadSession, error) {
+	uploadURL := ShotgunURL + fmt.Sprintf("/entity/%v/%v/_upload", entityType, entityID)
+	if fieldName != "" {
+		uploadURL = ShotgunURL + fmt.Sprintf("/entity/%v/%v/%v/_upload", entityType, entityID, fieldName)
+	}
+
+	req, err := http.NewRequest("GET", uploadURL, nil)
+	if err != nil {
+		logrus.WithError(err).Error("failed to create upload info request")
+		return nil, err
+	}
+	q := req.URL.Query()
+	q.Add("filename", fileName)
+	if multipart {
+		q.Add("multipart_upload", "true")
+	}
+	req.URL.RawQuery = q.Encode()
+
+	var resp uploadInfoResponse
+	if err = doUploadRequest(req, &resp); err != nil {
+		logrus.Error("failed to make upload info request")
+		return nil, err
+	}
+
+	return &UploadSession{
+		EntityType:  entityType,
+		EntityID:    entityID,
+		FieldName:   fieldName,
+		FileName:    fileName,
+		Size:        size,
+		UploadInfo:  resp.Data,
+		UploadURL:   resp.Links.Upload,
+		CompleteURL: resp.Links.CompleteUpload,
+		NextPartURL: resp.Links.GetNextPart,
+	}, nil
+}
+
+// nextUploadPart returns the upload link of the part after the last uploaded one, and the
+// link to request the part after it.
+func nextUploadPart(session *UploadSession) (string, string, error) {
+	if session.NextPartURL == "" {
+		return "", "", fmt.Errorf("upload of %v has no next part link", session.FileName)
+	}
+
+	req, err := http.NewRequest("GET", siteURL(session.NextPartURL), nil)
+	if err != nil {
+		logrus.WithError(err).Error("failed to create upload next part request")
+		return "", "", err
+	}
+
+	var resp uploadInfoResponse
+	if err = doUploadRequest(req, &resp); err != nil {
+		logrus.Error("failed to make upload next part request")
+		return "", "", err
+	}
+
+	return resp.Links.Upload, resp.Links.GetNextPart, nil
+}
+
+func putUploadPart(uploadURL, storageService, contentType string, body io.Reader, length, offset int64, progress func(sent int64)) (string, error) {
+	counter := &progressReader{reader: body, sent: offset, progress: progress}
+	req, err := http.NewRequest("PUT", siteURL(uploadURL), counter)
+	if err != nil {
+		logrus.WithError(err).Error("failed to create upload request")
+		return "", err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", contentType)
+
+	if storageService == "sg" {
+		auth, err := AuthenticateShotgunScript()
+		if err != nil {
+			logrus.Error("authentication failed")
+			return "", err
+		}
+		req.Header.Add("Authorization", fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken))
+	}
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		logrus.WithError(err).Error("failed to do upload request")
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("upload failed with status %v: %v", resp.StatusCode, string(bodyBytes))
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+func completeUpload(session *UploadSession, multipart bool, displayName string) error {
+	info := map[string]interface{}{}
+	if err := json.Unmarshal(session.UploadInfo, &info); err != nil {
+		logrus.Error("failed to unmarshal upload info")
+		return err
+	}
+	if multipart {
+		info["etags"] = session.ETags
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"upload_info": info,
+		"upload_data": map[string]interface{}{
+			"display_name": displayName,
+		},
+	})
+	if err != nil {
+		logrus.Error("failed to marshal complete upload request")
+		return err
+	}
+
+	req, err := http.NewRequest("POST", siteURL(session.CompleteURL), bytes.NewBuffer(body))
+	if err != nil {
+		logrus.WithError(err).Error("failed to create complete upload request")
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	if err = doUploadRequest(req, nil); err != nil {
+		logrus.Error("failed to make complete upload request")
+		return err
+	}
+	return nil
+}
+
+func doUploadRequest(req *http.Request, v interface{}) error {
+	auth, err := AuthenticateShotgunScript()
+	if err != nil {
+		logrus.Error("authentication failed")
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Authorization", fmt.Sprintf("%v %v", auth.TokenType, auth.AccessToken))
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		logrus.Error("failed to do upload request")
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return HandleError(resp)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logrus.Error("failed to read upload response")
+		return err
+	}
+
+	if v == nil || len(bodyBytes) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(bodyBytes, v); err != nil {
+		logrus.Error("failed to unmarshal upload response")
+		return err
+	}
+	return nil
+}
+
+// siteURL turns the site relative links returned by Shotgun, e.g. /api/v1/entity/..., into
+// absolute URLs. Absolute links such as storage service URLs are returned unchanged.
+func siteURL(link string) string {
+	if parsed, err := url.Parse(link); err == nil && parsed.IsAbs() {
+		return link
+	}
+	return strings.TrimSuffix(ShotgunURL, "/api/v1") + link
+}
+
+func contentTypeForFile(fileName string) string {
+	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(fileName)))
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+type progressReader struct {
+	reader   io.Reader
+	sent     int64
+	progress func(sent int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.sent += int64(n)
+	if n > 0 && p.progress != nil {
+		p.progress(p.sent)
+	}
+	return n, err
+}
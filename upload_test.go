@@ -0,0 +1,200 @@
+package shotgun_api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// uploadStub is a local stand-in for the Shotgun upload handshake with a multipart S3 upload.
+type uploadStub struct {
+	mutex     sync.Mutex
+	parts     map[int][]byte
+	failPart  int // PUT of this part number fails with a 500.
+	completed map[string]interface{}
+}
+
+func (s *uploadStub) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/auth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token": "token", "token_type": "Bearer", "expires_in": 600}`)
+	})
+
+	uploadPath := "/api/v1/entity/Version/1/sg_uploaded_movie/_upload"
+	writeLinks := func(w http.ResponseWriter, part int) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"storage_service":  "s3",
+				"multipart_upload": true,
+				"upload_id":        "upload-1",
+			},
+			"links": map[string]interface{}{
+				"upload":          fmt.Sprintf("/s3/part/%v", part),
+				"complete_upload": uploadPath,
+				"get_next_part":   fmt.Sprintf("%v/multipart?part=%v", uploadPath, part+1),
+			},
+		})
+	}
+
+	mux.HandleFunc(uploadPath, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			if r.URL.Query().Get("multipart_upload") != "true" {
+				http.Error(w, "expected a multipart upload", http.StatusBadRequest)
+				return
+			}
+			writeLinks(w, 1)
+		case "POST":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			s.mutex.Lock()
+			s.completed = body
+			s.mutex.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	mux.HandleFunc(uploadPath+"/multipart", func(w http.ResponseWriter, r *http.Request) {
+		part, _ := strconv.Atoi(r.URL.Query().Get("part"))
+		writeLinks(w, part)
+	})
+	mux.HandleFunc("/s3/part/", func(w http.ResponseWriter, r *http.Request) {
+		part, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/s3/part/"))
+		data, _ := ioutil.ReadAll(r.Body)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if part == s.failPart {
+			s.failPart = 0
+			http.Error(w, "storage unavailable", http.StatusInternalServerError)
+			return
+		}
+		s.parts[part] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%v"`, part))
+	})
+	return mux
+}
+
+func (s *uploadStub) assembled() []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var result []byte
+	for part := 1; part <= len(s.parts); part++ {
+		result = append(result, s.parts[part]...)
+	}
+	return result
+}
+
+func startUploadStub(t *testing.T, stub *uploadStub) {
+	server := httptest.NewServer(stub.handler())
+	previousURL := ShotgunURL
+	ShotgunURL = server.URL + "/api/v1"
+	t.Cleanup(func() {
+		ShotgunURL = previousURL
+		server.Close()
+	})
+}
+
+func writeUploadFile(t *testing.T, size int) (string, []byte) {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "movie.mov")
+	if err = ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, content
+}
+
+func completedETags(t *testing.T, stub *uploadStub) []interface{} {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	if stub.completed == nil {
+		t.Fatal("upload was not completed")
+	}
+	info, _ := stub.completed["upload_info"].(map[string]interface{})
+	etags, _ := info["etags"].([]interface{})
+	return etags
+}
+
+func TestUploadFileMultipart(t *testing.T) {
+	stub := &uploadStub{parts: map[int][]byte{}}
+	startUploadStub(t, stub)
+	path, content := writeUploadFile(t, 2*minUploadPartSize+1024)
+
+	var parts int
+	opts := UploadOptions{
+		PartSize: minUploadPartSize,
+		OnPart:   func(session *UploadSession) { parts++ },
+	}
+	if err := UploadFile("Version", 1, "sg_uploaded_movie", path, opts); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	if parts != 3 {
+		t.Errorf("uploaded %v parts, want 3", parts)
+	}
+	if !bytes.Equal(stub.assembled(), content) {
+		t.Error("uploaded parts do not match the file")
+	}
+	etags := completedETags(t, stub)
+	if want := []interface{}{`"etag-1"`, `"etag-2"`, `"etag-3"`}; fmt.Sprint(etags) != fmt.Sprint(want) {
+		t.Errorf("completed with etags %v, want %v", etags, want)
+	}
+	data, _ := stub.completed["upload_data"].(map[string]interface{})
+	if data["display_name"] != "movie.mov" {
+		t.Errorf("completed with display name %v, want movie.mov", data["display_name"])
+	}
+}
+
+func TestUploadFileResumesSavedSession(t *testing.T) {
+	stub := &uploadStub{parts: map[int][]byte{}, failPart: 2}
+	startUploadStub(t, stub)
+	path, content := writeUploadFile(t, 2*minUploadPartSize+1024)
+
+	var saved []byte
+	opts := UploadOptions{
+		PartSize: minUploadPartSize,
+		OnPart: func(session *UploadSession) {
+			saved, _ = json.Marshal(session)
+		},
+	}
+	if err := UploadFile("Version", 1, "sg_uploaded_movie", path, opts); err == nil {
+		t.Fatal("expected the upload of part 2 to fail")
+	}
+
+	var session UploadSession
+	if err := json.Unmarshal(saved, &session); err != nil {
+		t.Fatalf("saved session: %v", err)
+	}
+	if len(session.ETags) != 1 || session.UploadedBytes != minUploadPartSize {
+		t.Fatalf("saved session has %v parts and %v bytes, want 1 part of %v bytes", len(session.ETags), session.UploadedBytes, minUploadPartSize)
+	}
+
+	opts.Session = &session
+	if err := UploadFile("Version", 1, "sg_uploaded_movie", path, opts); err != nil {
+		t.Fatalf("resumed UploadFile: %v", err)
+	}
+
+	if !bytes.Equal(stub.assembled(), content) {
+		t.Error("uploaded parts do not match the file")
+	}
+	if etags := completedETags(t, stub); len(etags) != 3 {
+		t.Errorf("completed with %v etags, want 3", len(etags))
+	}
+}
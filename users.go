@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"os"
+	"strings"
 )
 
 var ShotgunURL = os.Getenv("SHOTGUN_URL") + "/api/v1"
@@ -125,3 +126,109 @@ func GetUserForID(userID int64) (*UserData, error) {
 		Groups:    resp.Data.Relationships.Groups.Data,
 	}, nil
 }
+
+// GetShotgunUsersByLogins returns the HumanUsers with the given logins, looked up with one
+// search request. Logins without a user are left out.
+func GetShotgunUsersByLogins(logins []string) ([]UserData, error) {
+	if len(logins) == 0 {
+		return nil, nil
+	}
+
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"login", "in", logins},
+		},
+	}
+	page := PageParam{
+		Size: maxSearchPageSize,
+	}
+	req, err := NewSearchRequest("HumanUser", filters, userFields, &page, nil)
+	if err != nil {
+		logrus.Error("failed to create Shotgun User search request")
+		return nil, err
+	}
+
+	var resp UserMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Shotgun User search request")
+		return nil, err
+	}
+
+	var result []UserData
+	for _, record := range resp.Data {
+		result = append(result, UserData{
+			ID:        record.ID,
+			Firstname: record.Attributes.Firstname,
+			Lastname:  record.Attributes.Lastname,
+			Login:     record.Attributes.Login,
+			Status:    record.Attributes.Status,
+			Groups:    record.Relationships.Groups.Data,
+		})
+	}
+
+	return result, nil
+}
+
+// DisplayName is the name Shotgun shows for the user.
+func (u *UserData) DisplayName() string {
+	return strings.TrimSpace(u.Firstname + " " + u.Lastname)
+}
+
+func (u *UserData) Link() LinkField {
+	return LinkField{ID: u.ID, Type: "HumanUser", Name: u.DisplayName()}
+}
+
+type GroupRecord struct {
+	ID         int64 `json:"id"`
+	Attributes struct {
+		Code string `json:"code"`
+	} `json:"attributes"`
+}
+
+type GroupMultiRecordResponse struct {
+	Data []GroupRecord `json:"data"`
+}
+
+func (t *GroupMultiRecordResponse) ReadRecord(data []byte) error {
+	err := json.Unmarshal(data, &t)
+	if err != nil {
+		logrus.Error("failed to unmarshal data to GroupMultiRecord")
+		return err
+	}
+	return nil
+}
+
+// GetGroupsByNames returns the Groups with the given names, looked up with one search
+// request. Names without a group are left out.
+func GetGroupsByNames(names []string) ([]LinkField, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"code", "in", names},
+		},
+	}
+	page := PageParam{
+		Size: maxSearchPageSize,
+	}
+	req, err := NewSearchRequest("Group", filters, []string{"id", "code"}, &page, nil)
+	if err != nil {
+		logrus.Error("failed to create Group search request")
+		return nil, err
+	}
+
+	var resp GroupMultiRecordResponse
+	if err = DoSearchRequest(req, &resp); err != nil {
+		logrus.Error("failed to make Group search request")
+		return nil, err
+	}
+
+	var result []LinkField
+	for _, record := range resp.Data {
+		result = append(result, LinkField{ID: record.ID, Type: "Group", Name: record.Attributes.Code})
+	}
+
+	return result, nil
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"math/rand"
 	"os"
-	"path/filepath"
+	"sync"
+	"time"
 )
 
 type VersionData struct {
@@ -21,6 +23,9 @@ type VersionData struct {
 	Entity       LinkField   `json:"entity"`
 	Project      LinkField   `json:"project"`
 	DownloadURL  string      `json:"download_url"`
+	MovieURL     string      `json:"movie_url"`
+	ThumbnailURL string      `json:"thumbnail_url"`
+	User         LinkField   `json:"user"` // The artist who submitted the Version.
 }
 
 var VersionFields = []string{
@@ -28,9 +33,16 @@ var VersionFields = []string{
 	"created_at", "sg_review_status", "sg_status_list",
 	"sg_version_number", "project", "sg_task", "entity",
 	"sg_download_uri", "description",
+	"sg_uploaded_movie", "image", "user",
 }
 
+// SetField updates a field of the Version. The review status can only be changed with
+// TransitionReviewStatus, which enforces the review workflow.
 func (v *VersionData) SetField(fieldName string, fieldValue interface{}) error {
+	if fieldName == reviewStatusField {
+		return fmt.Errorf("%v of Version %v must be changed with TransitionReviewStatus", fieldName, v.ID)
+	}
+
 	reqBody := map[string]interface{}{
 		fieldName: fieldValue,
 	}
@@ -60,52 +72,37 @@ func (v *VersionData) SetField(fieldName string, fieldValue interface{}) error {
 }
 
 func (v *VersionData) GetResourcePublishPath() (*string, bool, error) {
-	projectRoot := GetProjectPath(v.Project.Name)
+	ctx, err := NewContextFromEntity(LinkField{ID: v.ID, Type: "Version", Name: v.Name})
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to retrieve Context for Version (%v)", v.ID)
+		return nil, false, err
+	}
 
-	var entityGroup string
-	var entityGroupSubfolder string
+	var templateName string
 	switch v.Entity.Type {
 	case "Shot":
-		shotData, err := GetShotForID(v.Entity.ID)
-		if err != nil {
-			logrus.WithError(err).Errorf("failed to retrieve Shot for Version (%v)", v.ID)
-			return nil, false, err
-		}
-		entityGroupSubfolder = "sequences"
-		entityGroup = shotData.Sequence
+		templateName = ShotPublishTemplate
 	case "Asset":
-		assetData, err := GetAssetForID(v.Entity.ID)
-		if err != nil {
-			logrus.WithError(err).Errorf("failed to retrieve Asset for Version (%v)", v.ID)
-			return nil, false, err
-		}
-		entityGroupSubfolder = "assets"
-		entityGroup = assetData.Group
+		templateName = AssetPublishTemplate
+	default:
+		return nil, false, fmt.Errorf("no publish path template for %v entities", v.Entity.Type)
 	}
 
-	taskData, err := GetTaskFromID(v.Task.ID)
+	fields := ctx.TemplateFields()
+	fields["version"] = v.Number
+
+	template, err := PathTemplates.GetTemplate(ctx.Project.Name, templateName)
 	if err != nil {
-		logrus.WithError(err).Errorf("failed to retrieve Task for Version (%v)", v.ID)
+		logrus.WithError(err).Errorf("failed to get publish path template for Version (%v)", v.ID)
 		return nil, false, err
 	}
 
-	stepData, err := GetStepForID(taskData.Step.ID)
+	versionPath, err := template.Apply(fields)
 	if err != nil {
-		logrus.WithError(err).Errorf("failed to retrieve Step for Version (%v)", v.ID)
+		logrus.WithError(err).Errorf("failed to apply publish path template for Version (%v)", v.ID)
 		return nil, false, err
 	}
 
-	versionPath := filepath.Join(
-		projectRoot,
-		"production",
-		entityGroupSubfolder,
-		entityGroup,
-		v.Entity.Name,
-		stepData.ShortName,
-		"publish",
-		fmt.Sprintf("v%03d", v.Number),
-	)
-
 	_, err = os.Stat(versionPath)
 	versionPathExists := !os.IsNotExist(err)
 
@@ -122,6 +119,10 @@ type VersionRecord struct {
 		VersionNumber int64  `json:"sg_version_number"`
 		DownloadURI   string `json:"sg_download_uri"`
 		Description   string `json:"description"`
+		Movie         struct {
+			URL string `json:"url"`
+		} `json:"sg_uploaded_movie"`
+		Image string `json:"image"`
 	} `json:"attributes"`
 	Relationships struct {
 		OpenNotes struct {
@@ -136,6 +137,9 @@ type VersionRecord struct {
 		Project struct {
 			Data LinkField `json:"data"`
 		} `json:"project"`
+		User struct {
+			Data LinkField `json:"data"`
+		} `json:"user"`
 	} `json:"relationships"`
 }
 
@@ -164,6 +168,25 @@ func (t *VersionMultiRecordResponse) ReadRecord(data []byte) error {
 	return nil
 }
 
+func newVersionData(record VersionRecord) *VersionData {
+	return &VersionData{
+		ID:           record.ID,
+		Name:         record.Attributes.Code,
+		SubmittedAt:  record.Attributes.CreatedAt,
+		ReviewStatus: record.Attributes.ReviewStatus,
+		Status:       record.Attributes.Status,
+		Number:       record.Attributes.VersionNumber,
+		Task:         record.Relationships.Task.Data,
+		Project:      record.Relationships.Project.Data,
+		Entity:       record.Relationships.Entity.Data,
+		DownloadURL:  record.Attributes.DownloadURI,
+		Description:  record.Attributes.Description,
+		MovieURL:     record.Attributes.Movie.URL,
+		ThumbnailURL: record.Attributes.Image,
+		User:         record.Relationships.User.Data,
+	}
+}
+
 func GetVersionsForTask(taskID int64) ([]VersionData, error) {
 	filters := ShotgunFilters{
 		Expressions: []ShotgunFilterExpression{
@@ -194,21 +217,7 @@ func GetVersionsForTask(taskID int64) ([]VersionData, error) {
 
 	var result []VersionData
 	for _, record := range resp.Data {
-		version := VersionData{
-			ID:           record.ID,
-			Name:         record.Attributes.Code,
-			SubmittedAt:  record.Attributes.CreatedAt,
-			ReviewStatus: record.Attributes.ReviewStatus,
-			Status:       record.Attributes.Status,
-			Number:       record.Attributes.VersionNumber,
-			Task:         record.Relationships.Task.Data,
-			Project:      record.Relationships.Project.Data,
-			Entity:       record.Relationships.Entity.Data,
-			DownloadURL:  record.Attributes.DownloadURI,
-			Description:  record.Attributes.Description,
-		}
-
-		result = append(result, version)
+		result = append(result, *newVersionData(record))
 	}
 
 	return result, nil
@@ -227,18 +236,40 @@ func GetVersionForID(versionID int64) (*VersionData, error) {
 		return nil, err
 	}
 
-	result := &VersionData{
-		ID:           resp.Data.ID,
-		Name:         resp.Data.Attributes.Code,
-		SubmittedAt:  resp.Data.Attributes.CreatedAt,
-		ReviewStatus: resp.Data.Attributes.ReviewStatus,
-		Status:       resp.Data.Attributes.Status,
-		Number:       resp.Data.Attributes.VersionNumber,
-		Task:         resp.Data.Relationships.Task.Data,
-		Project:      resp.Data.Relationships.Project.Data,
-		Entity:       resp.Data.Relationships.Entity.Data,
-		DownloadURL:  resp.Data.Attributes.DownloadURI,
-		Description:  resp.Data.Attributes.Description,
+	return newVersionData(resp.Data), nil
+}
+
+func GetVersionsForIDs(versionIDs []int64) ([]VersionData, error) {
+	var result []VersionData
+	for start := 0; start < len(versionIDs); start += maxSearchPageSize {
+		end := start + maxSearchPageSize
+		if end > len(versionIDs) {
+			end = len(versionIDs)
+		}
+
+		filters := ShotgunFilters{
+			Expressions: []ShotgunFilterExpression{
+				{"id", "in", versionIDs[start:end]},
+			},
+		}
+		page := PageParam{
+			Size: maxSearchPageSize,
+		}
+		req, err := NewSearchRequest("Version", filters, VersionFields, &page, nil)
+		if err != nil {
+			logrus.Error("failed to create Version search request")
+			return nil, err
+		}
+
+		var resp VersionMultiRecordResponse
+		if err = DoSearchRequest(req, &resp); err != nil {
+			logrus.Error("failed to make Version search request")
+			return nil, err
+		}
+
+		for _, record := range resp.Data {
+			result = append(result, *newVersionData(record))
+		}
 	}
 
 	return result, nil
@@ -265,19 +296,282 @@ func FindOneVersion(filters ShotgunFilters, sortParams []SortParam) (*VersionDat
 		return nil, nil
 	}
 
-	version := VersionData{
-		ID:           resp.Data[0].ID,
-		Name:         resp.Data[0].Attributes.Code,
-		SubmittedAt:  resp.Data[0].Attributes.CreatedAt,
-		ReviewStatus: resp.Data[0].Attributes.ReviewStatus,
-		Status:       resp.Data[0].Attributes.Status,
-		Number:       resp.Data[0].Attributes.VersionNumber,
-		Task:         resp.Data[0].Relationships.Task.Data,
-		Project:      resp.Data[0].Relationships.Project.Data,
-		Entity:       resp.Data[0].Relationships.Entity.Data,
-		DownloadURL:  resp.Data[0].Attributes.DownloadURI,
-		Description:  resp.Data[0].Attributes.Description,
+	return newVersionData(resp.Data[0]), nil
+}
+
+const maxVersionAllocationAttempts = 10
+
+// NextVersionNumber reserves the next version number of a Version stream, identified by task,
+// entity and name. The reservation is a Version created with the allocated number, which the
+// caller fills in. After creating it, any other Version holding the same number is looked up
+// and the oldest one wins, so concurrent publishers never end up sharing a number.
+func NextVersionNumber(task, entity LinkField, name string) (*VersionData, error) {
+	project, err := versionStreamProject(task, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := maxVersionNumber(task, entity, name)
+	if err != nil {
+		return nil, err
+	}
+
+	candidate := latest + 1
+	for attempt := 0; attempt < maxVersionAllocationAttempts; attempt++ {
+		reserved, err := createVersionReservation(project, task, entity, name, candidate)
+		if err != nil {
+			return nil, err
+		}
+
+		filters := versionStreamFilters(task, entity, name)
+		filters.Expressions = append(filters.Expressions,
+			ShotgunFilterExpression{"sg_version_number", "is", candidate},
+		)
+		sort := []SortParam{
+			{
+				FieldName: "id",
+				Direction: Ascending,
+			},
+		}
+		winner, err := FindOneVersion(filters, sort)
+		if err != nil {
+			return nil, err
+		}
+		if winner == nil || winner.ID == reserved.ID {
+			return reserved, nil
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"name":           name,
+			"version_number": candidate,
+		}).Info("version number taken by a concurrent publish, retrying")
+		if err = deleteVersion(reserved.ID); err != nil {
+			return nil, err
+		}
+
+		latest, err = maxVersionNumber(task, entity, name)
+		if err != nil {
+			return nil, err
+		}
+		candidate++
+		if latest >= candidate {
+			candidate = latest + 1
+		}
+		time.Sleep(versionAllocationJitter(attempt))
+	}
+
+	return nil, fmt.Errorf("failed to allocate a version number for %v after %v attempts", name, maxVersionAllocationAttempts)
+}
+
+var (
+	jitterSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMutex  sync.Mutex
+)
+
+// versionAllocationJitter spreads out the retries of concurrent publishers. Its source is
+// seeded per process, so they do not all sleep for the same durations.
+func versionAllocationJitter(attempt int) time.Duration {
+	jitterMutex.Lock()
+	defer jitterMutex.Unlock()
+	return time.Duration(jitterSource.Intn(100*(attempt+1))) * time.Millisecond
+}
+
+// versionStreamFilters matches the Versions of a stream by their code, <name>.vNNN, so that
+// e.g. the stream "comp" does not include "comp_fg.v005".
+func versionStreamFilters(task, entity LinkField, name string) ShotgunFilters {
+	filters := ShotgunFilters{
+		Expressions: []ShotgunFilterExpression{
+			{"code", "starts_with", name + ".v"},
+		},
+	}
+	if task.ID > 0 {
+		filters.Expressions = append(filters.Expressions, ShotgunFilterExpression{"sg_task", "is", task.Ref()})
+	}
+	if entity.ID > 0 {
+		filters.Expressions = append(filters.Expressions, ShotgunFilterExpression{"entity", "is", entity.Ref()})
+	}
+	return filters
+}
+
+func maxVersionNumber(task, entity LinkField, name string) (int64, error) {
+	summaryFields := []SummaryField{
+		{"sg_version_number", MaximumSummary},
+	}
+	req, err := NewSummarizeRequest("Version", versionStreamFilters(task, entity, name), summaryFields)
+	if err != nil {
+		logrus.Error("failed to create Version summarize request")
+		return 0, err
+	}
+
+	resp, err := DoSummarizeRequest(req)
+	if err != nil {
+		logrus.Error("failed to make Version summarize request")
+		return 0, err
+	}
+
+	return resp.Int("sg_version_number"), nil
+}
+
+func versionStreamProject(task, entity LinkField) (LinkField, error) {
+	source := task
+	if source.ID == 0 {
+		source = entity
+	}
+	if source.ID == 0 {
+		return LinkField{}, fmt.Errorf("a Task or an entity is required to allocate a version number")
+	}
+
+	ctx, err := NewContextFromEntity(source)
+	if err != nil {
+		logrus.WithField("entity", source).Error("failed to retrieve Project for Version stream")
+		return LinkField{}, err
+	}
+	return ctx.Project, nil
+}
+
+func createVersionReservation(project, task, entity LinkField, name string, versionNumber int64) (*VersionData, error) {
+	body := map[string]interface{}{
+		"code":              fmt.Sprintf("%v.v%03d", name, versionNumber),
+		"project":           project.Ref(),
+		"sg_version_number": versionNumber,
+	}
+	if task.ID > 0 {
+		body["sg_task"] = task.Ref()
+	}
+	if entity.ID > 0 {
+		body["entity"] = entity.Ref()
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		logrus.Error("failed to marshal Version to JSON")
+		return nil, err
+	}
+
+	req, err := NewCreateRequest("Version", reqBody)
+	if err != nil {
+		logrus.Error("failed to create new Version request")
+		return nil, err
+	}
+
+	var resp VersionRecordResponse
+	if err = DoCreateRequest(req, &resp); err != nil {
+		logrus.Error("failed to make new Version request")
+		return nil, err
+	}
+
+	return &VersionData{
+		ID:      resp.Data.ID,
+		Name:    resp.Data.Attributes.Code,
+		Number:  versionNumber,
+		Task:    task,
+		Entity:  entity,
+		Project: project,
+	}, nil
+}
+
+func deleteVersion(versionID int64) error {
+	req, err := NewDeleteRequest("Version", versionID)
+	if err != nil {
+		logrus.Error("failed to create Version delete request")
+		return err
+	}
+
+	if err = DoDeleteRequest(req); err != nil {
+		logrus.WithField("version_id", versionID).Error("failed to delete Version")
+		return err
+	}
+	return nil
+}
+
+func updateVersionReservation(versionID int64, body map[string]interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		logrus.WithError(err).Error("failed to create request body")
+		return err
+	}
+
+	req, err := NewUpdateRequest("Version", versionID, VersionFields, data)
+	if err != nil {
+		logrus.Error("failed to create update Version request")
+		return err
+	}
+
+	var resp VersionRecordResponse
+	if err = DoUpdateRequest(req, &resp); err != nil {
+		logrus.Error("failed to make update Version request")
+		return err
+	}
+	return nil
+}
+
+type VersionOptions struct {
+	Name        string     // Name of the Version stream, the Version code is <name>.vNNN.
+	Description string     // Description of the Version.
+	Status      string     // Value of sg_status_list.
+	User        *LinkField // Artist the Version belongs to.
+	FramesPath  string     // Value of sg_path_to_frames.
+	MoviePath   string     // Movie uploaded to sg_uploaded_movie.
+	Upload      UploadOptions
+}
+
+// CreateVersion creates the next Version of a stream in the given context and uploads its
+// movie when MoviePath is set. When the upload fails, the created Version is returned with the
+// error, so the upload can be resumed with UploadFile and the UploadSession saved by OnPart.
+// When the Version can not be filled in, its reservation is deleted.
+func CreateVersion(ctx Context, opts VersionOptions) (*VersionData, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("a name is required to create a Version")
+	}
+
+	var task, entity LinkField
+	if ctx.Task != nil {
+		task = *ctx.Task
+	}
+	if ctx.Entity != nil {
+		entity = *ctx.Entity
+	}
+
+	reserved, err := NextVersionNumber(task, entity, opts.Name)
+	if err != nil {
+		logrus.WithField("name", opts.Name).Error("failed to allocate Version number")
+		return nil, err
+	}
+
+	body := map[string]interface{}{}
+	if opts.Description != "" {
+		body["description"] = opts.Description
+	}
+	if opts.Status != "" {
+		body["sg_status_list"] = opts.Status
+	}
+	if opts.User != nil {
+		body["user"] = opts.User.Ref()
+	} else if ctx.User != nil {
+		body["user"] = ctx.User.Ref()
+	}
+	if opts.FramesPath != "" {
+		body["sg_path_to_frames"] = opts.FramesPath
+	}
+	if opts.MoviePath != "" {
+		body["sg_path_to_movie"] = opts.MoviePath
+	}
+
+	if len(body) > 0 {
+		if err = updateVersionReservation(reserved.ID, body); err != nil {
+			if deleteErr := deleteVersion(reserved.ID); deleteErr != nil {
+				logrus.WithField("version_id", reserved.ID).Error("failed to delete Version reservation")
+			}
+			return nil, err
+		}
+	}
+
+	if opts.MoviePath != "" {
+		if err = UploadFile("Version", reserved.ID, "sg_uploaded_movie", opts.MoviePath, opts.Upload); err != nil {
+			logrus.WithField("version_id", reserved.ID).Error("failed to upload Version movie")
+			return reserved, err
+		}
 	}
 
-	return &version, nil
+	return GetVersionForID(reserved.ID)
 }